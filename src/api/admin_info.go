@@ -0,0 +1,53 @@
+package api
+
+import "time"
+
+type AdminUserQuery struct {
+	Search string `form:"q" binding:"max=32"`
+	Limit  string `form:"limit" binding:"omitempty,number,max=3"`
+	Offset string `form:"offset" binding:"omitempty,number,max=9"`
+}
+
+type AdminUserInfo struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	Disabled  bool      `json:"disabled"`
+	Devices   int       `json:"devices"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AdminUserInfoList struct {
+	Users []AdminUserInfo `json:"users"`
+	Total int64           `json:"total"`
+}
+
+type PasswordResetInfo struct {
+	Password string `json:"password" binding:"required,min=8,max=128"`
+}
+
+type ConnectedDeviceInfo struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	UserID   string `json:"user_id"`
+	Status   int    `json:"status"`
+	ParentID string `json:"parent_id,omitempty"`
+}
+
+type ConnectedDeviceInfoList struct {
+	InstanceID string                `json:"instance_id"`
+	Devices    []ConnectedDeviceInfo `json:"devices"`
+}
+
+type AdminAuditEntryInfo struct {
+	AuditEntryInfo
+	UserID string `json:"user_id"`
+}
+
+type SystemStatsInfo struct {
+	Users            int64 `json:"users"`
+	DisabledUsers    int64 `json:"disabled_users"`
+	Devices          int64 `json:"devices"`
+	ConnectedDevices int   `json:"connected_devices"`
+	Subscriptions    int   `json:"subscriptions"`
+}
@@ -0,0 +1,12 @@
+package api
+
+import "time"
+
+type AuditEntryInfo struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	DeviceID  string    `json:"device_id,omitempty"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Details   string    `json:"details,omitempty"`
+}
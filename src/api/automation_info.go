@@ -0,0 +1,53 @@
+package api
+
+import "time"
+
+type AutomationTriggerInfo struct {
+	Type        string `json:"type" binding:"required,oneof=device_offline status_changed device_on time_window"`
+	DeviceID    string `json:"device_id,omitempty" binding:"required_unless=Type time_window,omitempty,uuid"`
+	Status      *int   `json:"status,omitempty" binding:"omitempty,oneof=0 1"`
+	WindowStart string `json:"window_start,omitempty" binding:"required_if=Type time_window,omitempty,datetime=15:04"`
+	WindowEnd   string `json:"window_end,omitempty" binding:"required_if=Type time_window,omitempty,datetime=15:04"`
+}
+
+type AutomationActionInfo struct {
+	Type       string `json:"type" binding:"required,oneof=command webhook notify"`
+	DeviceID   string `json:"device_id,omitempty" binding:"required_if=Type command,omitempty,uuid"`
+	Command    string `json:"command,omitempty" binding:"required_if=Type command,omitempty,oneof=power reset hard_off"`
+	WebhookURL string `json:"webhook_url,omitempty" binding:"required_if=Type webhook,omitempty,http_url,max=2048"`
+	Message    string `json:"message,omitempty" binding:"max=256"`
+}
+
+type AutomationInfo struct {
+	ID          string                `json:"id"`
+	Name        string                `json:"name" binding:"required,min=1,max=32"`
+	Enabled     bool                  `json:"enabled"`
+	Debounce    int                   `json:"debounce" binding:"gte=0,lte=3600"`
+	Trigger     AutomationTriggerInfo `json:"trigger"`
+	Action      AutomationActionInfo  `json:"action"`
+	LastFiredAt *time.Time            `json:"last_fired_at"`
+}
+
+type AutomationDryRunInfo struct {
+	DeviceID string `json:"device_id" binding:"required_without=Time,omitempty,uuid"`
+	Online   bool   `json:"online"`
+	Status   int    `json:"status" binding:"oneof=0 1"`
+	Time     string `json:"time" binding:"omitempty,datetime=15:04"`
+}
+
+type AutomationDryRunResult struct {
+	AutomationID string               `json:"automation_id"`
+	Name         string               `json:"name"`
+	Debounce     int                  `json:"debounce"`
+	Action       AutomationActionInfo `json:"action"`
+}
+
+type AutomationWebhookPayload struct {
+	AutomationID string    `json:"automation_id"`
+	Name         string    `json:"name"`
+	Trigger      string    `json:"trigger"`
+	DeviceID     string    `json:"device_id,omitempty"`
+	Online       bool      `json:"online"`
+	Status       int       `json:"status"`
+	FiredAt      time.Time `json:"fired_at"`
+}
@@ -10,3 +10,7 @@ type RegisterCredentials struct {
 	Password string `json:"password" binding:"required,min=8,max=128"`
 	Confirm  string `json:"confirm" binding:"required,eqfield=Password"`
 }
+
+type AccountDeleteInfo struct {
+	Password string `json:"password" binding:"required"`
+}
@@ -1,19 +1,79 @@
 package api
 
+import "time"
+
 type DeviceCreateInfo struct {
-	Name string `json:"name" binding:"required,min=1,max=32"`
+	Name       string   `json:"name" binding:"required,min=1,max=32"`
+	WolRelay   bool     `json:"wol_relay"`
+	Channels   int      `json:"channels" binding:"gte=0,lte=16"`
+	MacAddress string   `json:"mac_address" binding:"omitempty,mac48"`
+	Host       string   `json:"host" binding:"omitempty,max=253,hostname_rfc1123|ip"`
+	Notes      string   `json:"notes" binding:"max=1024"`
+	Location   string   `json:"location" binding:"max=64"`
+	Icon       string   `json:"icon" binding:"omitempty,oneof=desktop laptop server workstation nas router media_center console other"`
+	Tags       []string `json:"tags" binding:"max=16,unique,dive,min=1,max=32,printascii"`
+}
+
+// DevicePatchInfo only changes the fields that are present, an empty string clears the optional ones
+type DevicePatchInfo struct {
+	Name       *string   `json:"name" binding:"omitnil,min=1,max=32"`
+	WolRelay   *bool     `json:"wol_relay"`
+	Channels   *int      `json:"channels" binding:"omitnil,gte=0,lte=16"`
+	MacAddress *string   `json:"mac_address" binding:"omitnil,eq=|mac48"`
+	Host       *string   `json:"host" binding:"omitnil,max=253,eq=|hostname_rfc1123|ip"`
+	Notes      *string   `json:"notes" binding:"omitnil,max=1024"`
+	Location   *string   `json:"location" binding:"omitnil,max=64"`
+	Icon       *string   `json:"icon" binding:"omitnil,eq=|oneof=desktop laptop server workstation nas router media_center console other"`
+	Tags       *[]string `json:"tags" binding:"omitnil,max=16,unique,dive,min=1,max=32,printascii"`
+}
+
+type ChannelCreateInfo struct {
+	Name    string `json:"name" binding:"required,min=1,max=32"`
+	Channel int    `json:"channel" binding:"gte=0,lte=15"`
 }
 
 type DeviceInfo struct {
-	ID     string `json:"id"`
-	Name   string `json:"name"`
-	Code   string `json:"code"`
-	Secret string `json:"secret"`
-	Status int    `json:"status"`
-	Online bool   `json:"online"`
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Code       string   `json:"code"`
+	Secret     string   `json:"secret"`
+	Status     int      `json:"status"`
+	Online     bool     `json:"online"`
+	WolRelay   bool     `json:"wol_relay"`
+	Channels   int      `json:"channels,omitempty"`
+	ParentID   string   `json:"parent_id,omitempty"`
+	Channel    *int     `json:"channel,omitempty"`
+	MacAddress string   `json:"mac_address"`
+	Host       string   `json:"host"`
+	Notes      string   `json:"notes"`
+	Location   string   `json:"location"`
+	Icon       string   `json:"icon"`
+	Tags       []string `json:"tags"`
 }
 
 type DeviceInfoList struct {
 	OnlineDevices  []DeviceInfo `json:"online"`
 	OfflineDevices []DeviceInfo `json:"offline"`
+	Total          int64        `json:"total"`
+	NextCursor     string       `json:"next_cursor,omitempty"`
+}
+
+type TrashedDeviceInfo struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	WolRelay  bool      `json:"wol_relay"`
+	Channels  int       `json:"channels,omitempty"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	Channel   *int      `json:"channel,omitempty"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type DeviceListQuery struct {
+	Search string   `form:"q" binding:"max=32"`
+	Tags   []string `form:"tag" binding:"max=16,unique,dive,min=1,max=32"`
+	Online string   `form:"online" binding:"omitempty,oneof=true false"`
+	Status string   `form:"status" binding:"omitempty,number,max=9"`
+	Sort   string   `form:"sort" binding:"omitempty,oneof=name -name created_at -created_at"`
+	Limit  string   `form:"limit" binding:"omitempty,number,max=3"`
+	Cursor string   `form:"cursor" binding:"max=512"`
 }
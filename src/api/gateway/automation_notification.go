@@ -0,0 +1,10 @@
+package gateway
+
+import "time"
+
+type AutomationNotification struct {
+	AutomationID string    `json:"automation_id"`
+	Name         string    `json:"name"`
+	Message      string    `json:"message"`
+	FiredAt      time.Time `json:"fired_at"`
+}
@@ -3,7 +3,10 @@ package gateway
 const PressPowerSwitchOpcode int = 1
 const PressResetSwitchOpcode int = 2
 const HardPowerOffOpcode int = 3
+const WakeOnLanOpcode int = 4
 
 type CommandMessage struct {
-	Opcode int `json:"op"`
+	Opcode  int    `json:"op"`
+	Channel *int   `json:"channel,omitempty"`
+	Mac     string `json:"mac,omitempty"`
 }
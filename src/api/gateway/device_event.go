@@ -0,0 +1,33 @@
+package gateway
+
+const DeviceCreatedEvent = "device.created"
+const DeviceUpdatedEvent = "device.updated"
+const DeviceDeletedEvent = "device.deleted"
+
+// DeviceSummary describes a device to the user clients without its credentials
+type DeviceSummary struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	WolRelay   bool     `json:"wol_relay"`
+	Channels   int      `json:"channels,omitempty"`
+	ParentID   string   `json:"parent_id,omitempty"`
+	Channel    *int     `json:"channel,omitempty"`
+	MacAddress string   `json:"mac_address"`
+	Host       string   `json:"host"`
+	Notes      string   `json:"notes"`
+	Location   string   `json:"location"`
+	Icon       string   `json:"icon"`
+	Tags       []string `json:"tags"`
+}
+
+type DeviceCreated struct {
+	DeviceSummary
+}
+
+type DeviceUpdated struct {
+	DeviceSummary
+}
+
+type DeviceDeleted struct {
+	ID string `json:"id"`
+}
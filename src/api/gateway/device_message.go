@@ -1,5 +1,6 @@
 package gateway
 
 type DeviceMessage struct {
-	Status int `json:"status" binding:"required,oneof=0 1"`
+	Status  int  `json:"status" binding:"required,oneof=0 1"`
+	Channel *int `json:"channel" binding:"omitempty,gte=0"`
 }
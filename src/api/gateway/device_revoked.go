@@ -0,0 +1,23 @@
+package gateway
+
+const DeviceRevokedEvent = "device.revoked"
+const AccountDeletedEvent = "account.deleted"
+const AccountDisabledEvent = "account.disabled"
+
+const DeviceDeletedReason = "the device has been deleted"
+const SecretRotatedReason = "the secret of the device has been rotated"
+const AccountDeletedReason = "the account owning the device has been deleted"
+const DeviceTransferredReason = "the device has been transferred to another user"
+
+type DeviceRevoked struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type AccountDeleted struct {
+	ID string `json:"id"`
+}
+
+type AccountDisabled struct {
+	ID string `json:"id"`
+}
@@ -0,0 +1,9 @@
+package gateway
+
+const StreamClosedEvent = "stream.closed"
+
+// StreamClosed is the last event of an event stream, Code is the close code the websocket would have used
+type StreamClosed struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
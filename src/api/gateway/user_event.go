@@ -0,0 +1,25 @@
+package gateway
+
+const SnapshotEvent = "snapshot"
+const DeviceStateEvent = "device.state"
+const AutomationNotificationEvent = "automation.notification"
+
+// UserEvent is numbered by the instance sending it, the cursor is the value to resume from after reconnecting, to any
+// instance. The seq is kept for the clients ordering the events
+type UserEvent struct {
+	Seq    uint64      `json:"seq"`
+	Cursor string      `json:"cursor"`
+	Type   string      `json:"type"`
+	Data   interface{} `json:"data"`
+}
+
+// Snapshot holds everything a client needs to render the devices of the user without calling the REST API
+type Snapshot struct {
+	Devices []SnapshotDevice `json:"devices"`
+}
+
+type SnapshotDevice struct {
+	DeviceSummary
+	Status int  `json:"status"`
+	Online bool `json:"online"`
+}
@@ -0,0 +1,17 @@
+package gateway
+
+type UserMessageArgs struct {
+	Hard bool `json:"hard"`
+}
+
+type UserMessage struct {
+	RequestID string          `json:"request_id" binding:"required,max=64"`
+	Action    string          `json:"action" binding:"required,oneof=power reset hard_off"`
+	DeviceID  string          `json:"device_id" binding:"required,uuid"`
+	Args      UserMessageArgs `json:"args"`
+}
+
+type UserResponse struct {
+	RequestID string `json:"request_id"`
+	Success   bool   `json:"success"`
+}
@@ -1,7 +1,8 @@
 package gateway
 
 type ErrorMessage struct {
-	Details ErrorDetails `json:"error"`
+	RequestID string       `json:"request_id,omitempty"`
+	Details   ErrorDetails `json:"error"`
 }
 
 type ErrorDetails struct {
@@ -11,6 +12,10 @@ type ErrorDetails struct {
 	Message     string `json:"message"`
 }
 
+func (err *ErrorMessage) SetRequestId(requestId string) {
+	err.RequestID = requestId
+}
+
 func (err *ErrorMessage) SetId(id string) {
 	err.Details.Id = id
 }
@@ -0,0 +1,24 @@
+package api
+
+import "time"
+
+type HealthInfo struct {
+	Status string `json:"status"`
+}
+
+// ReadinessInfo holds the result of every check, ok or the reason it failed
+type ReadinessInfo struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+type StatusInfo struct {
+	InstanceID       string    `json:"instance_id"`
+	Version          string    `json:"version"`
+	StartedAt        time.Time `json:"started_at"`
+	Uptime           int64     `json:"uptime"`
+	Draining         bool      `json:"draining"`
+	ConnectedDevices int       `json:"connected_devices"`
+	UserSessions     int       `json:"user_sessions"`
+	Subscriptions    int       `json:"subscriptions"`
+}
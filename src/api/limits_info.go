@@ -0,0 +1,14 @@
+package api
+
+// UsageInfo has a zero limit when the usage is unlimited
+type UsageInfo struct {
+	Used  int64 `json:"used"`
+	Limit int   `json:"limit"`
+}
+
+type LimitsInfo struct {
+	Devices           UsageInfo `json:"devices"`
+	Webhooks          UsageInfo `json:"webhooks"`
+	Schedules         UsageInfo `json:"schedules"`
+	CommandsPerMinute int       `json:"commands_per_minute"`
+}
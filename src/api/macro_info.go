@@ -0,0 +1,43 @@
+package api
+
+import "time"
+
+const MacroRunning = "running"
+const MacroSucceeded = "succeeded"
+const MacroFailed = "failed"
+const MacroStepPending = "pending"
+const MacroStepSkipped = "skipped"
+
+type MacroStepInfo struct {
+	Type     string `json:"type" binding:"required,oneof=command wait_state delay"`
+	DeviceID string `json:"device_id,omitempty" binding:"required_unless=Type delay,omitempty,uuid"`
+	Command  string `json:"command,omitempty" binding:"required_if=Type command,omitempty,oneof=power reset hard_off"`
+	Status   int    `json:"status" binding:"oneof=0 1"`
+	Timeout  int    `json:"timeout,omitempty" binding:"required_if=Type wait_state,gte=0,lte=3600"`
+	Duration int    `json:"duration,omitempty" binding:"required_if=Type delay,gte=0,lte=3600"`
+}
+
+type MacroInfo struct {
+	ID    string          `json:"id"`
+	Name  string          `json:"name" binding:"required,min=1,max=32"`
+	Steps []MacroStepInfo `json:"steps" binding:"required,min=1,max=50,dive"`
+}
+
+type MacroStepRunInfo struct {
+	Position   int        `json:"position"`
+	Type       string     `json:"type"`
+	DeviceID   string     `json:"device_id,omitempty"`
+	Status     string     `json:"status"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Error      string     `json:"error,omitempty"`
+}
+
+type MacroRunInfo struct {
+	ID         string             `json:"id"`
+	MacroID    string             `json:"macro_id"`
+	Status     string             `json:"status"`
+	StartedAt  time.Time          `json:"started_at"`
+	FinishedAt *time.Time         `json:"finished_at"`
+	Steps      []MacroStepRunInfo `json:"steps"`
+}
@@ -0,0 +1,24 @@
+package api
+
+import "time"
+
+type TransferCreateInfo struct {
+	Username           string `json:"username" binding:"required,min=1,max=32"`
+	ClearConfiguration bool   `json:"clear_configuration"`
+}
+
+type TransferInfo struct {
+	ID                 string    `json:"id"`
+	DeviceID           string    `json:"device_id"`
+	DeviceName         string    `json:"device_name"`
+	From               string    `json:"from"`
+	To                 string    `json:"to"`
+	ClearConfiguration bool      `json:"clear_configuration"`
+	CreatedAt          time.Time `json:"created_at"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+type TransferInfoList struct {
+	Incoming []TransferInfo `json:"incoming"`
+	Outgoing []TransferInfo `json:"outgoing"`
+}
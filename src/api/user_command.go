@@ -1,5 +1,9 @@
 package api
 
+const PowerCommand = "power"
+const ResetCommand = "reset"
+const HardPowerOffCommand = "hard_off"
+
 type UserCommand struct {
 	DeviceID string `json:"device_id" binding:"required,uuid"`
 	Hard     bool   `json:"hard"`
@@ -0,0 +1,9 @@
+package api
+
+type UserGatewayQuery struct {
+	Since string `form:"since" binding:"omitempty,max=64"`
+}
+
+type UserEventsHeader struct {
+	LastEventID string `header:"Last-Event-ID" binding:"omitempty,max=64"`
+}
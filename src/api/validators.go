@@ -0,0 +1,19 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"net"
+)
+
+// The mac validator also accepts the EUI-64 and InfiniBand addresses, a magic packet needs a 6 bytes address
+func init() {
+	if validate, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		validate.RegisterValidation("mac48", isMac48)
+	}
+}
+
+func isMac48(field validator.FieldLevel) bool {
+	mac, err := net.ParseMAC(field.Field().String())
+	return err == nil && len(mac) == 6
+}
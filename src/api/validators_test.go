@@ -0,0 +1,30 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin/binding"
+	"testing"
+)
+
+func TestMacAddressesHaveSixOctets(t *testing.T) {
+	for mac, valid := range map[string]bool{
+		"00:11:22:33:44:55":       true,
+		"00-11-22-33-44-55":       true,
+		"0011.2233.4455":          true,
+		"00:11:22:33:44:55:66:77": false,
+		"00:00:00:00:fe:80:00:00:00:00:00:00:02:00:5e:10:00:00:00:01": false,
+		"not a mac": false,
+	} {
+		err := binding.Validator.ValidateStruct(&WolTargetInfo{Name: "desktop", MacAddress: mac})
+		if (err == nil) != valid {
+			t.Errorf("%s: expected valid=%v, got %v", mac, valid, err)
+		}
+		err = binding.Validator.ValidateStruct(&DeviceCreateInfo{Name: "desktop", MacAddress: mac})
+		if (err == nil) != valid {
+			t.Errorf("%s: expected valid=%v for a device, got %v", mac, valid, err)
+		}
+	}
+	empty := ""
+	if err := binding.Validator.ValidateStruct(&DevicePatchInfo{MacAddress: &empty}); err != nil {
+		t.Errorf("expected the address to be cleared, got %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+package api
+
+import "time"
+
+type WatchdogStepInfo struct {
+	Action string `json:"action" binding:"required,oneof=power reset hard_off"`
+	Delay  int    `json:"delay" binding:"gte=0,lte=86400"`
+}
+
+type WatchdogInfo struct {
+	DeviceID         string             `json:"device_id"`
+	Enabled          bool               `json:"enabled"`
+	HeartbeatTimeout int                `json:"heartbeat_timeout" binding:"required,gte=60,lte=86400"`
+	Steps            []WatchdogStepInfo `json:"steps" binding:"required,min=1,max=10,dive"`
+	LastHeartbeat    *time.Time         `json:"last_heartbeat"`
+}
@@ -0,0 +1,12 @@
+package api
+
+type WolTargetInfo struct {
+	ID         string `json:"id"`
+	Name       string `json:"name" binding:"required,min=1,max=32"`
+	MacAddress string `json:"mac_address" binding:"required,mac48"`
+}
+
+type WakeOnLanCommand struct {
+	DeviceID string `json:"device_id" binding:"required,uuid"`
+	TargetID string `json:"target_id" binding:"required,uuid"`
+}
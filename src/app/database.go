@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"github.com/glebarez/sqlite"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/pc-power-api/src/config"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultMysqlPort = 3306
+const defaultPostgresPort = 5432
+
+func connectDatabase(databaseConfig config.DatabaseConfig) *gorm.DB {
+	if err := databaseConfig.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	var dialector gorm.Dialector
+	switch databaseConfig.Type {
+	case config.MysqlDatabase:
+		dialector = mysql.Open(mysqlDSN(databaseConfig))
+	case config.PostgresDatabase:
+		dialector = postgres.Open(postgresDSN(databaseConfig))
+	default:
+		dialector = sqlite.Open(sqliteDSN(databaseConfig))
+	}
+	// The errors are translated so that the repositories can recognize the duplicated keys of every driver
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return db
+}
+
+func mysqlDSN(databaseConfig config.DatabaseConfig) string {
+	if databaseConfig.DSN != "" {
+		return databaseConfig.DSN
+	}
+	dsn := mysqldriver.NewConfig()
+	dsn.User = databaseConfig.User
+	dsn.Passwd = databaseConfig.Password
+	dsn.Net = "tcp"
+	dsn.Addr = hostPort(databaseConfig.Host, databaseConfig.Port, defaultMysqlPort)
+	dsn.DBName = databaseConfig.Name
+	dsn.ParseTime = true
+	dsn.Loc = time.Local
+	dsn.Params = map[string]string{"charset": "utf8mb4"}
+	return dsn.FormatDSN()
+}
+
+func postgresDSN(databaseConfig config.DatabaseConfig) string {
+	if databaseConfig.DSN != "" {
+		return databaseConfig.DSN
+	}
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(databaseConfig.User, databaseConfig.Password),
+		Host:   hostPort(databaseConfig.Host, databaseConfig.Port, defaultPostgresPort),
+		Path:   "/" + databaseConfig.Name,
+	}
+	if databaseConfig.SSLMode != "" {
+		dsn.RawQuery = url.Values{"sslmode": {databaseConfig.SSLMode}}.Encode()
+	}
+	return dsn.String()
+}
+
+// sqliteDSN adds the journal mode and busy timeout pragmas to the DSN, or to the path when no DSN is given
+func sqliteDSN(databaseConfig config.DatabaseConfig) string {
+	dsn := databaseConfig.DSN
+	if dsn == "" {
+		dsn = databaseConfig.Path
+	}
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	pragmas := url.Values{"_pragma": {
+		fmt.Sprintf("journal_mode(%s)", strings.ToUpper(databaseConfig.JournalMode)),
+		fmt.Sprintf("busy_timeout(%d)", databaseConfig.BusyTimeout.Milliseconds()),
+	}}
+	return dsn + separator + pragmas.Encode()
+}
+
+func hostPort(host string, port int, defaultPort int) string {
+	if port == 0 {
+		port = defaultPort
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	apigateway "github.com/pc-power-api/src/api/gateway"
+	"github.com/pc-power-api/src/cluster"
+	"github.com/pc-power-api/src/config"
+	"github.com/pc-power-api/src/controller"
+	"github.com/pc-power-api/src/controller/gateway"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/infra/repo"
+	"github.com/pc-power-api/src/util"
+	"gorm.io/gorm"
+	"os"
+	"text/tabwriter"
+)
+
+func runDeviceCommand(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		failUsage("missing device command")
+	}
+	flags := flag.NewFlagSet("device "+args[0], flag.ExitOnError)
+	username := flags.String("user", "", "only list the devices of this user")
+	purge := flags.Bool("purge", false, "permanently delete the device instead of moving it to the trash")
+	flags.Parse(args[1:])
+	db := connectDatabase(cfg.Database)
+	deviceRepo := repo.NewDeviceRepository(db)
+
+	switch args[0] {
+	case "list":
+		listDevices(deviceRepo, repo.NewUserRepository(db), *username)
+		return
+	case "rotate-secret", "delete":
+	default:
+		failUsage("unknown device command " + args[0])
+	}
+	if flags.NArg() != 1 {
+		failUsage("the device id is required")
+	}
+	revoke := revoker(cfg.Cluster, db)
+	if args[0] == "rotate-secret" {
+		rotateSecret(deviceRepo, flags.Arg(0), revoke)
+	} else {
+		deleteDevice(deviceRepo, flags.Arg(0), *purge, revoke)
+	}
+}
+
+// revoker closes the sessions of the devices whose credentials changed. With the database backend the command joins
+// the cluster long enough to reach the instance holding the socket, the servers of a local cluster cannot be reached
+// and keep the session open until the device reconnects
+func revoker(clusterConfig config.ClusterConfig, db *gorm.DB) func(devices []entity.Device, reason string) {
+	if clusterConfig.Backend != config.DatabaseBackend {
+		return func(devices []entity.Device, reason string) {
+			fmt.Println("Warning: a running server with the local cluster backend keeps the session of the device " +
+				"open until it reconnects, restart it to close the session now")
+		}
+	}
+	return func(devices []entity.Device, reason string) {
+		gateway.StartCluster(cluster.NewDatabaseBackend(repo.NewClusterRepository(db)))
+		defer gateway.Cluster.Stop()
+		for i := range devices {
+			gateway.RevokeDevice(&devices[i], reason)
+		}
+	}
+}
+
+func listDevices(deviceRepo *repo.DeviceRepository, userRepo *repo.UserRepository, username string) {
+	userId := ""
+	if username != "" {
+		user, aerr := userRepo.GetByUsername(username)
+		if aerr != nil {
+			fail(aerr)
+		}
+		userId = user.ID
+	}
+	devices, aerr := deviceRepo.GetAll()
+	if aerr != nil {
+		fail(aerr)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tNAME\tCODE\tUSER ID\tRELAY BOARD\tCREATED AT")
+	for _, device := range devices {
+		if userId != "" && device.UserID != userId {
+			continue
+		}
+		code := ""
+		if device.Code != nil {
+			code = *device.Code
+		}
+		parentId := ""
+		if device.ParentID != nil {
+			parentId = *device.ParentID
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", device.ID, device.Name, code, device.UserID, parentId, device.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	writer.Flush()
+}
+
+func rotateSecret(deviceRepo *repo.DeviceRepository, deviceId string, revoke func([]entity.Device, string)) {
+	device, aerr := deviceRepo.GetById(deviceId)
+	if aerr != nil {
+		fail(aerr)
+	}
+	if device.ParentID != nil {
+		fail(controller.ChannelHasNoCredentials)
+	}
+	revoked := *device
+	device.Secret = util.GenerateRandomString(controller.DeviceSecretLength)
+	if aerr = deviceRepo.Update(device); aerr != nil {
+		fail(aerr)
+	}
+	revoke([]entity.Device{revoked}, apigateway.SecretRotatedReason)
+	fmt.Println("The new secret of the device " + device.Name + " is " + device.Secret)
+}
+
+func deleteDevice(deviceRepo *repo.DeviceRepository, deviceId string, purge bool, revoke func([]entity.Device, string)) {
+	device, aerr := deviceRepo.GetById(deviceId)
+	if aerr != nil && purge {
+		device, aerr = deviceRepo.GetTrashedById(deviceId)
+	}
+	if aerr != nil {
+		fail(aerr)
+	}
+	channels, aerr := deviceRepo.GetChannels(device.ID)
+	if aerr != nil {
+		fail(aerr)
+	}
+	if purge {
+		aerr = deviceRepo.Purge(device)
+	} else {
+		aerr = deviceRepo.Delete(device)
+	}
+	if aerr != nil {
+		fail(aerr)
+	}
+	revoke(append(channels, *device), apigateway.DeviceDeletedReason)
+	if purge {
+		fmt.Println("Permanently deleted the device " + device.Name)
+	} else {
+		fmt.Println("Moved the device " + device.Name + " to the trash")
+	}
+}
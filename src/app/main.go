@@ -1,66 +1,70 @@
 package main
 
 import (
-	"github.com/gin-gonic/gin"
-	"github.com/glebarez/sqlite"
-	"github.com/pc-power-api/src/controller"
-	"github.com/pc-power-api/src/controller/middleware"
-	"github.com/pc-power-api/src/infra/entity"
-	"github.com/pc-power-api/src/infra/repo"
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
-	"log"
+	"fmt"
+	"github.com/pc-power-api/src/config"
 	"os"
 )
 
-func main() {
-	r := gin.Default()
-	r.SetTrustedProxies([]string{"127.0.0.1", "::1"})
-
-	db := connectDatabase()
-	err := db.AutoMigrate(&entity.User{}, &entity.Device{})
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	deviceRepository := repo.NewDeviceRepository(db)
-	userRepository := repo.NewUserRepository(db)
+const usage = `Usage: api [-config file] [-port port] [-db-type type] [-cluster-backend backend]
+           [-admin-username username] [command]
 
-	authenticationMiddleWare := middleware.NewAuthenticationMiddleware(userRepository)
-	authMiddlewareHandlerFunction, authMiddlewareHandler := authenticationMiddleWare.AuthMiddleware()
+Commands:
+  serve                                 Start the API, the default command
+  migrate status                        List the migrations and whether they are applied
+  migrate up [-to version]              Apply the pending migrations, up to the version when given
+  migrate down [-steps n]               Revert the latest applied migrations, 1 by default
+  user create [-admin] [-password p] <username>
+  user disable <username>
+  user enable <username>
+  user reset-password [-password p] <username>
+  device list [-user username]
+  device rotate-secret <device id>
+  device delete [-purge] <device id>
+  export [-o file]                      Write every account and device as json, to stdout by default
+  import [-i file]                      Read an export into an empty database, from stdin by default
 
-	r.Use(authMiddlewareHandlerFunction)
-	r.Use(middleware.ExceptionHandler())
+The passwords not given as a flag are read from the standard input.
+`
 
-	controller.NewAuthHandler(r, authMiddlewareHandler, userRepository)
-	controller.NewUsersHandler(r, authMiddlewareHandler, userRepository, deviceRepository)
-	controller.NewDevicesHandler(r, authMiddlewareHandler, deviceRepository, userRepository)
+func main() {
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		fail(err)
+	}
+	if len(args) == 0 {
+		serve(cfg)
+		return
+	}
+	command, args := args[0], args[1:]
+	switch command {
+	case "serve":
+		serve(cfg)
+	case "migrate":
+		runMigrate(cfg, args)
+	case "user":
+		runUserCommand(cfg, args)
+	case "device":
+		runDeviceCommand(cfg, args)
+	case "export":
+		runExport(cfg, args)
+	case "import":
+		runImport(cfg, args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		failUsage("unknown command " + command)
+	}
+}
 
-	port := os.Getenv("PORT")
-	log.Fatal(r.Run(":" + port))
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "Error: "+err.Error())
+	os.Exit(1)
 }
 
-func connectDatabase() *gorm.DB {
-	if os.Getenv("DBTYPE") == "mysql" {
-		username := os.Getenv("DBUSER")
-		password := os.Getenv("DBPASS")
-		host := os.Getenv("DBHOST")
-		port := os.Getenv("DBPORT")
-		dbname := os.Getenv("DBNAME")
-		dsn := username + ":" + password + "@tcp(" + host + ":" + port + ")/" + dbname + "?charset=utf8mb4&parseTime=True&loc=Local"
-		db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
-		if err != nil {
-			log.Fatal(err)
-		}
-		return db
-	} else if os.Getenv("DBTYPE") == "sqlite" {
-		db, err := gorm.Open(sqlite.Open("db/gorm.db"), &gorm.Config{})
-		if err != nil {
-			log.Fatal(err)
-		}
-		return db
-	} else {
-		log.Fatal("Database type not supported")
-		return nil
-	}
+// failUsage is used when the command line itself is wrong
+func failUsage(message string) {
+	fmt.Fprintln(os.Stderr, "Error: "+message)
+	fmt.Fprint(os.Stderr, "\n"+usage)
+	os.Exit(2)
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/config"
+	"github.com/pc-power-api/src/infra/migration"
+	"time"
+)
+
+func runMigrate(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		failUsage("missing migrate command")
+	}
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	to := flags.Uint("to", 0, "the version to migrate up to, the latest one when missing")
+	steps := flags.Int("steps", 1, "the number of migrations to revert")
+	flags.Parse(args[1:])
+	migrator := migration.NewMigrator(connectDatabase(cfg.Database))
+
+	switch args[0] {
+	case "status":
+		printMigrationStatus(migrator)
+	case "up":
+		done, aerr := migrator.Up(*to)
+		printMigrations("Applied", done, aerr)
+	case "down":
+		if *steps < 1 {
+			failUsage("the number of steps must be at least 1")
+		}
+		done, aerr := migrator.Down(*steps)
+		printMigrations("Reverted", done, aerr)
+	default:
+		failUsage("unknown migrate command " + args[0])
+	}
+}
+
+func printMigrationStatus(migrator *migration.Migrator) {
+	statuses, aerr := migrator.Status()
+	if aerr != nil {
+		fail(aerr)
+	}
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%4d  %-30s %s\n", status.Version, status.Name, applied)
+	}
+	if aerr := migrator.Check(context.Background()); aerr != nil {
+		fmt.Println(aerr.Error())
+	}
+}
+
+// printMigrations lists the migrations done before failing on the error, if any
+func printMigrations(verb string, migrations []migration.Migration, aerr *errors.Error) {
+	for _, migration := range migrations {
+		fmt.Printf("%s %d %s\n", verb, migration.Version, migration.Name)
+	}
+	if aerr != nil {
+		fail(aerr)
+	}
+	if len(migrations) == 0 {
+		fmt.Println("Nothing to do")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/pc-power-api/src/automation"
+	"github.com/pc-power-api/src/cluster"
+	"github.com/pc-power-api/src/config"
+	"github.com/pc-power-api/src/controller"
+	"github.com/pc-power-api/src/controller/gateway"
+	"github.com/pc-power-api/src/controller/middleware"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/infra/migration"
+	"github.com/pc-power-api/src/infra/repo"
+	"github.com/pc-power-api/src/limits"
+	"github.com/pc-power-api/src/macro"
+	"github.com/pc-power-api/src/trash"
+	"github.com/pc-power-api/src/watchdog"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// serve starts the http server along with the background jobs
+func serve(cfg *config.Config) {
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	r := gin.Default()
+	err := r.SetTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db := connectDatabase(cfg.Database)
+	migrator := migration.NewMigrator(db)
+	if aerr := migrator.Check(context.Background()); aerr != nil {
+		log.Fatal(aerr)
+	}
+
+	deviceRepository := repo.NewDeviceRepository(db)
+	userRepository := repo.NewUserRepository(db)
+	watchdogRepository := repo.NewWatchdogRepository(db)
+	auditRepository := repo.NewAuditRepository(db)
+	automationRepository := repo.NewAutomationRepository(db)
+	macroRepository := repo.NewMacroRepository(db)
+	macroRunRepository := repo.NewMacroRunRepository(db)
+	wolTargetRepository := repo.NewWolTargetRepository(db)
+	transferRepository := repo.NewTransferRepository(db)
+	clusterRepository := repo.NewClusterRepository(db)
+	healthRepository := repo.NewHealthRepository(db)
+
+	gateway.Configure(cfg.Gateway.PingPeriod, cfg.Gateway.PongWait, cfg.Server.CORS.AllowedOrigins)
+	gateway.StartCluster(newClusterBackend(cfg.Cluster, clusterRepository))
+	limits.Configure(cfg.Limits)
+	promoteAdmin(userRepository, cfg.AdminUsername)
+
+	automationEngine := automation.NewEngine(automationRepository, auditRepository)
+	macroRunner := macro.NewRunner(auditRepository, macroRunRepository)
+
+	authenticationMiddleWare := middleware.NewAuthenticationMiddleware(userRepository, cfg.Auth)
+	authMiddlewareHandlerFunction, authMiddlewareHandler := authenticationMiddleWare.AuthMiddleware()
+
+	r.Use(middleware.Metrics())
+	r.Use(middleware.CORS(cfg.Server.CORS))
+	r.Use(authMiddlewareHandlerFunction)
+	r.Use(middleware.ExceptionHandler())
+
+	controller.NewAuthHandler(r, authMiddlewareHandler, userRepository)
+	controller.NewUsersHandler(r, authMiddlewareHandler, userRepository, deviceRepository)
+	controller.NewTransfersHandler(r, authMiddlewareHandler, userRepository, deviceRepository, transferRepository)
+	controller.NewDevicesHandler(r, authMiddlewareHandler, deviceRepository, userRepository, wolTargetRepository)
+	controller.NewWatchdogsHandler(r, authMiddlewareHandler, deviceRepository, watchdogRepository)
+	controller.NewAuditHandler(r, authMiddlewareHandler, auditRepository)
+	controller.NewAutomationsHandler(r, authMiddlewareHandler, automationRepository, userRepository, automationEngine)
+	controller.NewMacrosHandler(r, authMiddlewareHandler, macroRepository, userRepository, macroRunner)
+	controller.NewWolTargetsHandler(r, authMiddlewareHandler, deviceRepository, wolTargetRepository)
+	controller.NewLimitsHandler(r, authMiddlewareHandler, deviceRepository, automationRepository)
+	controller.NewAdminHandler(r, authMiddlewareHandler, userRepository, deviceRepository, auditRepository)
+	controller.NewHealthHandler(r, authMiddlewareHandler, healthRepository, migrator)
+	controller.NewMetricsHandler(r)
+
+	evaluator := watchdog.NewEvaluator(watchdogRepository, deviceRepository, auditRepository)
+	evaluator.Start()
+	automationEngine.Start()
+	jobs := []stopper{evaluator, automationEngine, macroRunner}
+	if cfg.Trash.RetentionDays > 0 {
+		purger := trash.NewPurger(deviceRepository, time.Duration(cfg.Trash.RetentionDays)*24*time.Hour)
+		purger.Start()
+		jobs = append(jobs, purger)
+	}
+
+	server := &http.Server{
+		Addr:    ":" + strconv.Itoa(cfg.Server.Port),
+		Handler: r,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	<-ctx.Done()
+	stop()
+	shutdown(server, db, cfg, jobs)
+}
+
+// stopper is a background job that must be stopped before the database is closed
+type stopper interface {
+	Stop()
+}
+
+// shutdown stops accepting connections, lets the requests and commands in progress finish and closes the sessions of
+// the clients, then stops the background jobs before leaving the cluster and closing the database
+func shutdown(server *http.Server, db *gorm.DB, cfg *config.Config, jobs []stopper) {
+	log.Println("Shutting down, waiting up to " + cfg.Server.ShutdownTimeout.String() + " for the clients")
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	// The listener is closed right away while the server waits for the requests, the event streams among them are
+	// only ended by the gateway
+	serverStopped := make(chan error, 1)
+	go func() { serverStopped <- server.Shutdown(ctx) }()
+	gateway.Drain(ctx, cfg.Gateway.ReconnectDelay)
+	if err := <-serverStopped; err != nil {
+		log.Println(err)
+		server.Close()
+	}
+
+	for _, job := range jobs {
+		job.Stop()
+	}
+	gateway.Cluster.Stop()
+	sqlDB, err := db.DB()
+	if err == nil {
+		err = sqlDB.Close()
+	}
+	if err != nil {
+		log.Println(err)
+	}
+	log.Println("Shut down")
+}
+
+// promoteAdmin gives the administrator role to the user configured, once registered
+func promoteAdmin(userRepository *repo.UserRepository, username string) {
+	if username == "" {
+		return
+	}
+	user, aerr := userRepository.GetByUsername(username)
+	if aerr != nil {
+		log.Println("The administrator " + username + " could not be promoted: " + aerr.Error())
+		return
+	}
+	if user.Role == entity.AdminRole {
+		return
+	}
+	aerr = userRepository.SetRole(user, entity.AdminRole)
+	if aerr != nil {
+		log.Fatal(aerr.ErrorStack())
+	}
+}
+
+func newClusterBackend(clusterConfig config.ClusterConfig, clusterRepository *repo.ClusterRepository) cluster.Backend {
+	if clusterConfig.Backend == config.DatabaseBackend {
+		return cluster.NewDatabaseBackend(clusterRepository)
+	}
+	return cluster.NewLocalBackend()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/pc-power-api/src/config"
+	"github.com/pc-power-api/src/infra/migration"
+	"github.com/pc-power-api/src/infra/repo"
+	"io"
+	"os"
+)
+
+func runExport(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	output := flags.String("o", "", "the file to write, the standard output when missing")
+	flags.Parse(args)
+
+	snapshot, aerr := repo.NewSnapshotRepository(connectDatabase(cfg.Database)).Export()
+	if aerr != nil {
+		fail(aerr)
+	}
+
+	var writer io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fail(err)
+		}
+		defer file.Close()
+		writer = file
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(snapshot); err != nil {
+		fail(err)
+	}
+	if *output != "" {
+		fmt.Printf("Exported %d users and %d devices to %s\n", len(snapshot.Users), len(snapshot.Devices), *output)
+	}
+}
+
+// runImport creates the tables first so that an export can be restored on a new database
+func runImport(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	input := flags.String("i", "", "the file to read, the standard input when missing")
+	flags.Parse(args)
+
+	var reader io.Reader = os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			fail(err)
+		}
+		defer file.Close()
+		reader = file
+	}
+	var snapshot repo.Snapshot
+	if err := json.NewDecoder(reader).Decode(&snapshot); err != nil {
+		fail(err)
+	}
+
+	db := connectDatabase(cfg.Database)
+	if _, aerr := migration.NewMigrator(db).Up(0); aerr != nil {
+		fail(aerr)
+	}
+	if aerr := repo.NewSnapshotRepository(db).Import(&snapshot); aerr != nil {
+		fail(aerr)
+	}
+	fmt.Printf("Imported %d users and %d devices\n", len(snapshot.Users), len(snapshot.Devices))
+}
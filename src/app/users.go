@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/api"
+	"github.com/pc-power-api/src/config"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/infra/repo"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"strings"
+)
+
+func runUserCommand(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		failUsage("missing user command")
+	}
+	flags := flag.NewFlagSet("user "+args[0], flag.ExitOnError)
+	admin := flags.Bool("admin", false, "give the administrator role to the user")
+	password := flags.String("password", "", "the password, read from the standard input when missing")
+	flags.Parse(args[1:])
+	if flags.NArg() != 1 {
+		failUsage("the username is required")
+	}
+	username := flags.Arg(0)
+	userRepo := repo.NewUserRepository(connectDatabase(cfg.Database))
+
+	switch args[0] {
+	case "create":
+		createUser(userRepo, username, readPassword(*password), *admin)
+	case "disable":
+		setUserDisabled(userRepo, username, true)
+	case "enable":
+		setUserDisabled(userRepo, username, false)
+	case "reset-password":
+		resetPassword(userRepo, username, readPassword(*password))
+	default:
+		failUsage("unknown user command " + args[0])
+	}
+}
+
+// createUser applies the rules of the registration endpoint
+func createUser(userRepo *repo.UserRepository, username string, password string, admin bool) {
+	err := binding.Validator.ValidateStruct(&api.RegisterCredentials{
+		Username: username,
+		Password: password,
+		Confirm:  password,
+	})
+	if err != nil {
+		fail(err)
+	}
+	user := entity.User{
+		ID:       uuid.New().String(),
+		Username: username,
+		Password: hashPassword(password),
+		Role:     entity.UserRole,
+	}
+	if admin {
+		user.Role = entity.AdminRole
+	}
+	if aerr := userRepo.Create(&user); aerr != nil {
+		fail(aerr)
+	}
+	fmt.Println("Created the user " + user.Username + " with the id " + user.ID)
+}
+
+// setUserDisabled only applies to the new sessions of a running server, the open ones are closed by the admin API
+func setUserDisabled(userRepo *repo.UserRepository, username string, disabled bool) {
+	user, aerr := userRepo.GetByUsername(username)
+	if aerr != nil {
+		fail(aerr)
+	}
+	if aerr = userRepo.SetDisabled(user, disabled); aerr != nil {
+		fail(aerr)
+	}
+	if disabled {
+		fmt.Println("Disabled the user " + user.Username)
+	} else {
+		fmt.Println("Enabled the user " + user.Username)
+	}
+}
+
+func resetPassword(userRepo *repo.UserRepository, username string, password string) {
+	err := binding.Validator.ValidateStruct(&api.PasswordResetInfo{Password: password})
+	if err != nil {
+		fail(err)
+	}
+	user, aerr := userRepo.GetByUsername(username)
+	if aerr != nil {
+		fail(aerr)
+	}
+	if aerr = userRepo.SetPassword(user, hashPassword(password)); aerr != nil {
+		fail(aerr)
+	}
+	fmt.Println("Reset the password of the user " + user.Username)
+}
+
+func readPassword(password string) string {
+	if password != "" {
+		return password
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		fail(err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+func hashPassword(password string) string {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		fail(err)
+	}
+	return string(hashedPassword)
+}
@@ -0,0 +1,330 @@
+package automation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/api"
+	apigateway "github.com/pc-power-api/src/api/gateway"
+	"github.com/pc-power-api/src/controller/gateway"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/infra/repo"
+	"github.com/pc-power-api/src/limits"
+	"github.com/pc-power-api/src/pubsub"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const DeviceOnStatus = 1
+const TimeLayout = "15:04"
+const TimeWindowPeriod = time.Minute
+const WebhookTimeout = 10 * time.Second
+const EventQueueSize = 1024
+
+// Engine runs the automations triggered by the devices connected to this instance. The states of the devices
+// connected to the other instances are kept as well so that the previous state of a device is known when it moves to
+// this instance
+type Engine struct {
+	automationRepo *repo.AutomationRepository
+	auditRepo      *repo.AuditRepository
+	httpClient     *http.Client
+	mu             sync.Mutex
+	states         map[string]apigateway.DeviceState
+	pending        map[string]*time.Timer
+	subscription   *pubsub.Subscription
+	stop           chan struct{}
+	stopping       bool
+	running        sync.WaitGroup
+}
+
+func NewEngine(automationRepo *repo.AutomationRepository, auditRepo *repo.AuditRepository) *Engine {
+	return &Engine{
+		automationRepo: automationRepo,
+		auditRepo:      auditRepo,
+		httpClient:     newWebhookClient(),
+		states:         make(map[string]apigateway.DeviceState),
+		pending:        make(map[string]*time.Timer),
+		stop:           make(chan struct{}),
+	}
+}
+
+func (e *Engine) Start() {
+	e.subscription = pubsub.Subscribe(e, pubsub.SubscriptionOptions{
+		QueueSize: EventQueueSize,
+		Policy:    pubsub.DropPolicy,
+		AllTopics: true,
+	})
+	e.seedStates()
+	e.running.Add(1)
+	go func() {
+		defer e.running.Done()
+		e.watchTimeWindows()
+	}()
+}
+
+// Stop cancels the debounced automations and waits for the ones being evaluated or fired
+func (e *Engine) Stop() {
+	e.subscription.Close()
+	e.mu.Lock()
+	e.stopping = true
+	for id, timer := range e.pending {
+		timer.Stop()
+		delete(e.pending, id)
+	}
+	e.mu.Unlock()
+	close(e.stop)
+	e.running.Wait()
+}
+
+// track counts a task as running until the returned function is called, ok is false once the engine is stopping
+func (e *Engine) track() (done func(), ok bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopping {
+		return nil, false
+	}
+	e.running.Add(1)
+	return e.running.Done, true
+}
+
+// goFire fires the automation in the background unless the engine is stopping
+func (e *Engine) goFire(automation *entity.Automation, state apigateway.DeviceState) {
+	done, ok := e.track()
+	if !ok {
+		return
+	}
+	go func() {
+		defer done()
+		e.fire(automation, state)
+	}()
+}
+
+// seedStates starts from the shared states of the devices triggering automations, the devices connected to the other
+// instances would otherwise look offline until they report again. The states received meanwhile are kept
+func (e *Engine) seedStates() {
+	deviceIds, err := e.automationRepo.GetEnabledTriggerDeviceIds()
+	if err != nil {
+		log.Println(err.ErrorStack())
+		return
+	}
+	states := gateway.GetDeviceStates(deviceIds...)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for deviceId, state := range states {
+		if _, ok := e.states[deviceId]; !ok {
+			e.states[deviceId] = state
+		}
+	}
+}
+
+// Notify evaluates the state changes of the devices connected to this instance, the instance holding a device is the
+// only one running the automations it triggers. The changes received from the other instances are only recorded
+func (e *Engine) Notify(event pubsub.Event) {
+	state, ok := event.Data.(apigateway.DeviceState)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	previous := e.states[state.ID]
+	e.states[state.ID] = state
+	e.mu.Unlock()
+	if event.Remote {
+		return
+	}
+
+	done, ok := e.track()
+	if !ok {
+		return
+	}
+	defer done()
+
+	automations, err := e.automationRepo.GetEnabledByTriggerDevice(state.ID)
+	if err != nil {
+		log.Println(err.ErrorStack())
+		return
+	}
+	for i := range automations {
+		if triggered(&automations[i], previous, state) {
+			e.schedule(&automations[i], state)
+		}
+	}
+}
+
+// DryRun returns the automations that would fire if the device went from its current state, wherever it is
+// connected, to the state of the given event, without executing them. The webhooks are never called
+func (e *Engine) DryRun(automations []entity.Automation, event *api.AutomationDryRunInfo) []entity.Automation {
+	matches := make([]entity.Automation, 0)
+	var now time.Time
+	if event.Time != "" {
+		now, _ = clockToday(event.Time, time.Now())
+	}
+
+	var previous apigateway.DeviceState
+	if event.DeviceID != "" {
+		previous = gateway.GetDeviceState(event.DeviceID)
+	}
+	current := apigateway.DeviceState{
+		ID:     event.DeviceID,
+		Status: event.Status,
+		Online: event.Online,
+	}
+
+	for _, automation := range automations {
+		if !automation.Enabled {
+			continue
+		}
+		if automation.TriggerType == entity.TimeWindowTrigger {
+			if !now.IsZero() && inWindow(&automation, now) {
+				matches = append(matches, automation)
+			}
+		} else if event.DeviceID != "" && automation.TriggerDeviceID == event.DeviceID && triggered(&automation, previous, current) {
+			matches = append(matches, automation)
+		}
+	}
+	return matches
+}
+
+// schedule fires the automation once the triggering state has been stable for the debounce period
+func (e *Engine) schedule(automation *entity.Automation, state apigateway.DeviceState) {
+	if automation.Debounce == 0 {
+		e.goFire(automation, state)
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.pending[automation.ID]; ok {
+		return
+	}
+	e.pending[automation.ID] = time.AfterFunc(time.Duration(automation.Debounce)*time.Second, func() {
+		done, ok := e.track()
+		if !ok {
+			return
+		}
+		defer done()
+		e.mu.Lock()
+		delete(e.pending, automation.ID)
+		current := e.states[state.ID]
+		e.mu.Unlock()
+		if holds(automation, state, current) {
+			e.fire(automation, current)
+		}
+	})
+}
+
+func (e *Engine) watchTimeWindows() {
+	ticker := time.NewTicker(TimeWindowPeriod)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-e.stop:
+			return
+		case now = <-ticker.C:
+		}
+		automations, err := e.automationRepo.GetEnabledByTrigger(entity.TimeWindowTrigger)
+		if err != nil {
+			log.Println(err.ErrorStack())
+			continue
+		}
+		for i := range automations {
+			automation := &automations[i]
+			if !inWindow(automation, now) {
+				continue
+			}
+			opened := windowOpenedAt(automation, now)
+			if automation.LastFiredAt != nil && !automation.LastFiredAt.Before(opened) {
+				continue
+			}
+			// Every instance evaluates the windows, the one claiming the window first fires the automation
+			claimed, aerr := e.automationRepo.ClaimWindow(automation.ID, opened, now)
+			if aerr != nil {
+				log.Println(aerr.ErrorStack())
+				continue
+			}
+			if claimed {
+				e.goFire(automation, apigateway.DeviceState{})
+			}
+		}
+	}
+}
+
+func (e *Engine) fire(automation *entity.Automation, state apigateway.DeviceState) {
+	firedAt := time.Now()
+	if aerr := e.automationRepo.UpdateLastFired(automation.ID, firedAt); aerr != nil {
+		log.Println(aerr.ErrorStack())
+	}
+
+	deviceId := automation.TriggerDeviceID
+	details := "triggered by " + automation.TriggerType
+	var err error
+	switch automation.ActionType {
+	case entity.CommandAction:
+		deviceId = automation.ActionDeviceID
+		details += ", sent " + automation.ActionCommand
+		// The commands of the automations count towards the same rate as the ones sent by their owner, a refused
+		// command is audited as a failed run
+		aerr := limits.AllowCommand(automation.ActionDeviceID)
+		if aerr == nil {
+			aerr = gateway.SendCommand(automation.ActionDeviceID, automation.ActionCommand)
+		}
+		if aerr != nil {
+			err = aerr
+		}
+	case entity.WebhookAction:
+		details += ", called " + automation.WebhookURL
+		err = e.callWebhook(automation, state, firedAt)
+	case entity.NotifyAction:
+		gateway.Publish(automation.UserID, apigateway.AutomationNotification{
+			AutomationID: automation.ID,
+			Name:         automation.Name,
+			Message:      automation.Message,
+			FiredAt:      firedAt,
+		})
+	}
+	if err != nil {
+		details += ", failed: " + err.Error()
+	}
+
+	aerr := e.auditRepo.Create(&entity.AuditEntry{
+		ID:       uuid.New().String(),
+		UserID:   automation.UserID,
+		DeviceID: deviceId,
+		Actor:    entity.AutomationActor,
+		Action:   automation.ActionType,
+		Details:  automation.Name + ": " + details,
+	})
+	if aerr != nil {
+		log.Println(aerr.ErrorStack())
+	}
+}
+
+func (e *Engine) callWebhook(automation *entity.Automation, state apigateway.DeviceState, firedAt time.Time) error {
+	payload, err := json.Marshal(api.AutomationWebhookPayload{
+		AutomationID: automation.ID,
+		Name:         automation.Name,
+		Trigger:      automation.TriggerType,
+		DeviceID:     state.ID,
+		Online:       state.Online,
+		Status:       state.Status,
+		FiredAt:      firedAt,
+	})
+	if err != nil {
+		return err
+	}
+	if err = checkWebhookURL(automation.WebhookURL); err != nil {
+		return err
+	}
+	response, err := e.httpClient.Post(automation.WebhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("the webhook responded with status %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package automation
+
+import (
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/api"
+	apigateway "github.com/pc-power-api/src/api/gateway"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/pubsub"
+	"testing"
+)
+
+func TestEngineRecordsTheRemoteStates(t *testing.T) {
+	engine := NewEngine(nil, nil)
+	deviceId := uuid.New().String()
+	state := apigateway.DeviceState{ID: deviceId, Status: DeviceOnStatus, Online: true}
+
+	// The automations are run by the instance holding the device, the repositories are not reached
+	engine.Notify(pubsub.Event{Topic: deviceId, Data: state, Remote: true})
+	if engine.states[deviceId] != state {
+		t.Fatalf("expected the state reported on another instance to be kept, got %+v", engine.states[deviceId])
+	}
+}
+
+func TestDryRunStartsFromTheSharedState(t *testing.T) {
+	engine := NewEngine(nil, nil)
+	deviceId := uuid.New().String()
+	automations := []entity.Automation{{ID: "on", Enabled: true, TriggerType: entity.DeviceOnTrigger, TriggerDeviceID: deviceId}}
+
+	// A state known to this instance only must not change the answer, the device is offline for the cluster
+	engine.states[deviceId] = apigateway.DeviceState{ID: deviceId, Status: DeviceOnStatus, Online: true}
+	matches := engine.DryRun(automations, &api.AutomationDryRunInfo{DeviceID: deviceId, Status: DeviceOnStatus, Online: true})
+	if len(matches) != 1 {
+		t.Fatalf("expected the device turning on to trigger the automation, got %+v", matches)
+	}
+}
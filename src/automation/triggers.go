@@ -0,0 +1,73 @@
+package automation
+
+import (
+	"github.com/pc-power-api/src/api/gateway"
+	"github.com/pc-power-api/src/infra/entity"
+	"time"
+)
+
+// triggered tells if the transition between two states of the trigger device matches the automation
+func triggered(automation *entity.Automation, previous gateway.DeviceState, current gateway.DeviceState) bool {
+	switch automation.TriggerType {
+	case entity.DeviceOfflineTrigger:
+		return previous.Online && !current.Online
+	case entity.StatusChangedTrigger:
+		statusMatches := automation.TriggerStatus == nil || *automation.TriggerStatus == current.Status
+		return previous.Online && current.Online && previous.Status != current.Status && statusMatches
+	case entity.DeviceOnTrigger:
+		wasOn := previous.Online && previous.Status == DeviceOnStatus
+		return !wasOn && current.Online && current.Status == DeviceOnStatus
+	}
+	return false
+}
+
+// holds tells if the state that triggered the automation is still the current one once the debounce period is over
+func holds(automation *entity.Automation, trigger gateway.DeviceState, current gateway.DeviceState) bool {
+	switch automation.TriggerType {
+	case entity.DeviceOfflineTrigger:
+		return !current.Online
+	case entity.StatusChangedTrigger:
+		return current.Online && current.Status == trigger.Status
+	case entity.DeviceOnTrigger:
+		return current.Online && current.Status == DeviceOnStatus
+	}
+	return false
+}
+
+func inWindow(automation *entity.Automation, now time.Time) bool {
+	start, err := clockToday(automation.WindowStart, now)
+	if err != nil {
+		return false
+	}
+	end, err := clockToday(automation.WindowEnd, now)
+	if err != nil {
+		return false
+	}
+	if start.Equal(end) {
+		return true
+	}
+	if start.Before(end) {
+		return !now.Before(start) && now.Before(end)
+	}
+	return !now.Before(start) || now.Before(end)
+}
+
+// windowOpenedAt returns the last time the window of the automation opened before now
+func windowOpenedAt(automation *entity.Automation, now time.Time) time.Time {
+	start, err := clockToday(automation.WindowStart, now)
+	if err != nil {
+		return now
+	}
+	if start.After(now) {
+		return start.AddDate(0, 0, -1)
+	}
+	return start
+}
+
+func clockToday(clock string, now time.Time) (time.Time, error) {
+	parsed, err := time.Parse(TimeLayout, clock)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), parsed.Hour(), parsed.Minute(), 0, 0, now.Location()), nil
+}
@@ -0,0 +1,61 @@
+package automation
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// newWebhookClient returns a client that only reaches public addresses. The address is checked once resolved, right
+// before connecting, so a name resolving to a public address when validated and to a private one later is refused
+// too. The redirects are not followed since they could lead anywhere
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: WebhookTimeout,
+		Control: checkWebhookAddress,
+	}
+	return &http.Client{
+		Timeout: WebhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: WebhookTimeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     time.Minute,
+		},
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// checkWebhookURL refuses the schemes other than http and https
+func checkWebhookURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("the webhook URL scheme %q is not allowed", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return fmt.Errorf("the webhook URL has no host")
+	}
+	return nil
+}
+
+func checkWebhookAddress(network string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	ip := addrPort.Addr().Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("the webhook address %s is not public", ip)
+	}
+	return nil
+}
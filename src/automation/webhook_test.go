@@ -0,0 +1,58 @@
+package automation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckWebhookURL(t *testing.T) {
+	for rawURL, allowed := range map[string]bool{
+		"https://example.com/hook":  true,
+		"http://example.com:8080/x": true,
+		"file:///etc/passwd":        false,
+		"gopher://example.com":      false,
+		"http:///path":              false,
+	} {
+		if err := checkWebhookURL(rawURL); (err == nil) != allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", rawURL, allowed, err)
+		}
+	}
+}
+
+func TestCheckWebhookAddress(t *testing.T) {
+	for address, allowed := range map[string]bool{
+		"93.184.215.14:443":          true,
+		"[2606:2800:21f:cb07::1]:80": true,
+		"127.0.0.1:80":               false,
+		"[::1]:80":                   false,
+		"10.1.2.3:80":                false,
+		"192.168.1.10:80":            false,
+		"169.254.169.254:80":         false,
+		"0.0.0.0:80":                 false,
+		"[::ffff:127.0.0.1]:80":      false,
+		"[fd00::1]:80":               false,
+		"[fe80::1]:80":               false,
+	} {
+		if err := checkWebhookAddress("tcp", address, nil); (err == nil) != allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", address, allowed, err)
+		}
+	}
+}
+
+func TestWebhookClientRefusesLocalServers(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	response, err := newWebhookClient().Post(server.URL, "application/json", nil)
+	if err == nil {
+		response.Body.Close()
+		t.Fatal("the local server was reached")
+	}
+	if called {
+		t.Fatal("the request was sent to the local server")
+	}
+}
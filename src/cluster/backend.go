@@ -0,0 +1,42 @@
+package cluster
+
+import "github.com/go-errors/errors"
+
+// Presence tells which instance holds the socket of a connected device
+type Presence struct {
+	DeviceID   string
+	InstanceID string
+	Status     int
+}
+
+// Command is sent to the instance holding the device, the channel fields identify the channel of a relay board to
+// attach or detach
+type Command struct {
+	DeviceID  string `json:"device_id"`
+	Name      string `json:"name"`
+	Mac       string `json:"mac,omitempty"`
+	Secret    string `json:"secret,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	ChannelID string `json:"channel_id,omitempty"`
+	Channel   int    `json:"channel,omitempty"`
+}
+
+// Handler executes on this instance what the other instances send to it
+type Handler interface {
+	HandleCommand(command Command) *errors.Error
+	HandleEvent(topic string, data interface{})
+}
+
+// Backend shares the device connections and the published events between the instances of the API
+type Backend interface {
+	InstanceID() string
+	Start(handler Handler)
+	// Stop leaves the cluster, the devices still claimed by this instance are released
+	Stop()
+	Claim(deviceId string, status int) *errors.Error
+	Release(deviceId string) *errors.Error
+	// Locate returns the presences of the given devices that are connected to another instance
+	Locate(deviceIds ...string) map[string]Presence
+	Forward(presence Presence, command Command) *errors.Error
+	Broadcast(topic string, data interface{}) *errors.Error
+}
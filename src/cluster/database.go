@@ -0,0 +1,309 @@
+package cluster
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/infra/repo"
+	"log"
+	"sync"
+	"time"
+)
+
+const PollPeriod = 250 * time.Millisecond
+const InstanceHeartbeatPeriod = 5 * time.Second
+const InstanceTimeout = 3 * InstanceHeartbeatPeriod
+const MessageRetention = time.Minute
+const ForwardTimeout = 10 * time.Second
+
+// MessageSettleDelay is longer than any insert of a message may take to commit. The ids are allocated on insert but
+// become visible on commit, so a message may appear after one with a higher id has been read
+const MessageSettleDelay = 5 * time.Second
+
+type commandPayload struct {
+	RequestID string  `json:"request_id"`
+	Command   Command `json:"command"`
+}
+
+// messageMark is the highest message id read by a poll
+type messageMark struct {
+	id     uint
+	readAt time.Time
+}
+
+type resultPayload struct {
+	RequestID string `json:"request_id"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DatabaseBackend shares the presences through a table of the database and exchanges the commands and the events
+// through a messages table polled by every instance. The polls read every message after a cursor trailing the highest
+// id read by MessageSettleDelay, the messages read more than once are skipped
+type DatabaseBackend struct {
+	id          string
+	clusterRepo *repo.ClusterRepository
+	handler     Handler
+	cursor      uint
+	marks       []messageMark
+	seen        map[uint]struct{}
+	mu          sync.Mutex
+	pending     map[string]chan resultPayload
+	stop        chan struct{}
+	stopped     sync.WaitGroup
+}
+
+func NewDatabaseBackend(clusterRepo *repo.ClusterRepository) *DatabaseBackend {
+	return &DatabaseBackend{
+		id:          uuid.New().String(),
+		clusterRepo: clusterRepo,
+		mu:          sync.Mutex{},
+		pending:     make(map[string]chan resultPayload),
+		seen:        make(map[uint]struct{}),
+		stop:        make(chan struct{}),
+	}
+}
+
+func (b *DatabaseBackend) InstanceID() string {
+	return b.id
+}
+
+func (b *DatabaseBackend) Start(handler Handler) {
+	b.handler = handler
+	if err := b.clusterRepo.Heartbeat(b.id, time.Now()); err != nil {
+		log.Println(err.ErrorStack())
+	}
+	lastMessageId, err := b.clusterRepo.GetLastMessageId()
+	if err != nil {
+		log.Println(err.ErrorStack())
+	}
+	b.cursor = lastMessageId
+
+	b.stopped.Add(2)
+	go b.heartbeat()
+	go b.poll()
+}
+
+// Stop waits for the polling to end before removing the instance so that it is not recorded again
+func (b *DatabaseBackend) Stop() {
+	close(b.stop)
+	b.stopped.Wait()
+	if err := b.clusterRepo.DeleteInstance(b.id); err != nil {
+		log.Println(err.ErrorStack())
+	}
+}
+
+func (b *DatabaseBackend) Claim(deviceId string, status int) *errors.Error {
+	return b.clusterRepo.SavePresence(&entity.DevicePresence{
+		DeviceID:   deviceId,
+		InstanceID: b.id,
+		Status:     status,
+	})
+}
+
+func (b *DatabaseBackend) Release(deviceId string) *errors.Error {
+	return b.clusterRepo.DeletePresence(deviceId, b.id)
+}
+
+func (b *DatabaseBackend) Locate(deviceIds ...string) map[string]Presence {
+	located := make(map[string]Presence)
+	if len(deviceIds) == 0 {
+		return located
+	}
+	presences, err := b.clusterRepo.GetPresences(deviceIds, time.Now().Add(-InstanceTimeout))
+	if err != nil {
+		log.Println(err.ErrorStack())
+		return located
+	}
+	for _, presence := range presences {
+		if presence.InstanceID == b.id {
+			continue
+		}
+		located[presence.DeviceID] = Presence{
+			DeviceID:   presence.DeviceID,
+			InstanceID: presence.InstanceID,
+			Status:     presence.Status,
+		}
+	}
+	return located
+}
+
+// Forward sends the command to the instance holding the device and waits for it to be executed
+func (b *DatabaseBackend) Forward(presence Presence, command Command) *errors.Error {
+	requestId := uuid.New().String()
+	payload, err := json.Marshal(commandPayload{
+		RequestID: requestId,
+		Command:   command,
+	})
+	if err != nil {
+		return errors.New(err)
+	}
+
+	result := make(chan resultPayload, 1)
+	b.mu.Lock()
+	b.pending[requestId] = result
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.pending, requestId)
+		b.mu.Unlock()
+	}()
+
+	aerr := b.clusterRepo.CreateMessage(&entity.ClusterMessage{
+		Source:  b.id,
+		Target:  presence.InstanceID,
+		Kind:    entity.CommandClusterMessage,
+		Payload: string(payload),
+	})
+	if aerr != nil {
+		return aerr
+	}
+
+	select {
+	case response := <-result:
+		if response.Error != "" {
+			return errors.New(exceptions.NewDeviceUnreachable(response.Error))
+		}
+		return nil
+	case <-time.After(ForwardTimeout):
+		return errors.New(InstanceUnreachableError)
+	}
+}
+
+func (b *DatabaseBackend) Broadcast(topic string, data interface{}) *errors.Error {
+	payload, err := encodeEvent(topic, data)
+	if err != nil {
+		return errors.New(err)
+	}
+	return b.clusterRepo.CreateMessage(&entity.ClusterMessage{
+		Source:  b.id,
+		Kind:    entity.EventClusterMessage,
+		Payload: payload,
+	})
+}
+
+func (b *DatabaseBackend) heartbeat() {
+	defer b.stopped.Done()
+	ticker := time.NewTicker(InstanceHeartbeatPeriod)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-b.stop:
+			return
+		case now = <-ticker.C:
+		}
+		if err := b.clusterRepo.Heartbeat(b.id, now); err != nil {
+			log.Println(err.ErrorStack())
+		}
+		if err := b.clusterRepo.DeleteStaleInstances(now.Add(-InstanceTimeout)); err != nil {
+			log.Println(err.ErrorStack())
+		}
+		if err := b.clusterRepo.DeleteMessagesBefore(now.Add(-MessageRetention)); err != nil {
+			log.Println(err.ErrorStack())
+		}
+	}
+}
+
+func (b *DatabaseBackend) poll() {
+	defer b.stopped.Done()
+	ticker := time.NewTicker(PollPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+		messages, err := b.clusterRepo.GetMessagesAfter(b.cursor, b.id)
+		if err != nil {
+			log.Println(err.ErrorStack())
+			continue
+		}
+		var highest uint
+		for _, message := range messages {
+			highest = max(highest, message.ID)
+			if _, ok := b.seen[message.ID]; ok {
+				continue
+			}
+			b.seen[message.ID] = struct{}{}
+			b.handleMessage(&message)
+		}
+		b.advanceCursor(highest, time.Now())
+	}
+}
+
+// advanceCursor moves the cursor to the highest id read at least MessageSettleDelay ago, every message below it has
+// been committed and read since
+func (b *DatabaseBackend) advanceCursor(highest uint, now time.Time) {
+	if highest > 0 && (len(b.marks) == 0 || highest > b.marks[len(b.marks)-1].id) {
+		b.marks = append(b.marks, messageMark{id: highest, readAt: now})
+	}
+	for len(b.marks) > 0 && now.Sub(b.marks[0].readAt) >= MessageSettleDelay {
+		b.cursor = max(b.cursor, b.marks[0].id)
+		b.marks = b.marks[1:]
+	}
+	for id := range b.seen {
+		if id <= b.cursor {
+			delete(b.seen, id)
+		}
+	}
+}
+
+func (b *DatabaseBackend) handleMessage(message *entity.ClusterMessage) {
+	switch message.Kind {
+	case entity.CommandClusterMessage:
+		var payload commandPayload
+		if err := json.Unmarshal([]byte(message.Payload), &payload); err != nil {
+			log.Println(err)
+			return
+		}
+		go b.execute(message.Source, payload)
+	case entity.ResultClusterMessage:
+		var payload resultPayload
+		if err := json.Unmarshal([]byte(message.Payload), &payload); err != nil {
+			log.Println(err)
+			return
+		}
+		b.mu.Lock()
+		result, ok := b.pending[payload.RequestID]
+		b.mu.Unlock()
+		if ok {
+			select {
+			case result <- payload:
+			default:
+			}
+		}
+	case entity.EventClusterMessage:
+		topic, data, err := decodeEvent(message.Payload)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		b.handler.HandleEvent(topic, data)
+	}
+}
+
+func (b *DatabaseBackend) execute(source string, payload commandPayload) {
+	response := resultPayload{
+		RequestID: payload.RequestID,
+	}
+	if err := b.handler.HandleCommand(payload.Command); err != nil {
+		response.Error = err.Error()
+	}
+	result, err := json.Marshal(response)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	aerr := b.clusterRepo.CreateMessage(&entity.ClusterMessage{
+		Source:  b.id,
+		Target:  source,
+		Kind:    entity.ResultClusterMessage,
+		Payload: string(result),
+	})
+	if aerr != nil {
+		log.Println(aerr.ErrorStack())
+	}
+}
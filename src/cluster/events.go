@@ -0,0 +1,64 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var eventTypesMu = sync.RWMutex{}
+var eventTypes = make(map[string]reflect.Type)
+var eventNames = make(map[reflect.Type]string)
+
+type eventEnvelope struct {
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// RegisterEvent allows the events carrying the type of the sample to be sent to the other instances
+func RegisterEvent(name string, sample interface{}) {
+	eventTypesMu.Lock()
+	defer eventTypesMu.Unlock()
+	eventType := reflect.TypeOf(sample)
+	eventTypes[name] = eventType
+	eventNames[eventType] = name
+}
+
+func encodeEvent(topic string, data interface{}) (string, error) {
+	eventTypesMu.RLock()
+	name, ok := eventNames[reflect.TypeOf(data)]
+	eventTypesMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("the event type %T is not registered", data)
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(eventEnvelope{
+		Topic: topic,
+		Type:  name,
+		Data:  raw,
+	})
+	return string(payload), err
+}
+
+func decodeEvent(payload string) (string, interface{}, error) {
+	var envelope eventEnvelope
+	if err := json.Unmarshal([]byte(payload), &envelope); err != nil {
+		return "", nil, err
+	}
+	eventTypesMu.RLock()
+	eventType, ok := eventTypes[envelope.Type]
+	eventTypesMu.RUnlock()
+	if !ok {
+		return "", nil, fmt.Errorf("the event type %s is not registered", envelope.Type)
+	}
+	data := reflect.New(eventType)
+	if err := json.Unmarshal(envelope.Data, data.Interface()); err != nil {
+		return "", nil, err
+	}
+	return envelope.Topic, data.Elem().Interface(), nil
+}
@@ -0,0 +1,48 @@
+package cluster
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/exceptions"
+)
+
+var InstanceUnreachableError = exceptions.NewDeviceUnreachable("the instance holding the device could not be reached")
+
+// LocalBackend is used when a single instance of the API is running, every device is then connected to it
+type LocalBackend struct {
+	id string
+}
+
+func NewLocalBackend() *LocalBackend {
+	return &LocalBackend{
+		id: uuid.New().String(),
+	}
+}
+
+func (b *LocalBackend) InstanceID() string {
+	return b.id
+}
+
+func (b *LocalBackend) Start(handler Handler) {}
+
+func (b *LocalBackend) Stop() {}
+
+func (b *LocalBackend) Claim(deviceId string, status int) *errors.Error {
+	return nil
+}
+
+func (b *LocalBackend) Release(deviceId string) *errors.Error {
+	return nil
+}
+
+func (b *LocalBackend) Locate(deviceIds ...string) map[string]Presence {
+	return map[string]Presence{}
+}
+
+func (b *LocalBackend) Forward(presence Presence, command Command) *errors.Error {
+	return errors.New(InstanceUnreachableError)
+}
+
+func (b *LocalBackend) Broadcast(topic string, data interface{}) *errors.Error {
+	return nil
+}
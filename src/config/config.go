@@ -0,0 +1,159 @@
+package config
+
+import (
+	"flag"
+	"github.com/pc-power-api/src/limits"
+	"gopkg.in/yaml.v3"
+	"os"
+	"time"
+)
+
+// Config holds the settings of the API. They are read from the defaults, then the configuration file, then the
+// environment variables and lastly the command line flags, each source overriding the previous ones
+type Config struct {
+	Server        ServerConfig   `yaml:"server"`
+	Database      DatabaseConfig `yaml:"database"`
+	Auth          AuthConfig     `yaml:"auth"`
+	Gateway       GatewayConfig  `yaml:"gateway"`
+	Cluster       ClusterConfig  `yaml:"cluster"`
+	Trash         TrashConfig    `yaml:"trash"`
+	Limits        limits.Limits  `yaml:"limits"`
+	AdminUsername string         `yaml:"admin_username"`
+}
+
+// ServerConfig.ShutdownTimeout bounds how long the API waits for the requests, commands and sessions to end when stopped
+type ServerConfig struct {
+	Port            int           `yaml:"port"`
+	TrustedProxies  []string      `yaml:"trusted_proxies"`
+	CORS            CORSConfig    `yaml:"cors"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// CORSConfig lists the origins allowed to call the API from a browser, none are allowed when it is empty
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins"`
+	AllowCredentials bool          `yaml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age"`
+}
+
+// DatabaseConfig either holds a complete DSN or the options it is built from, the DSN is used as is when present
+type DatabaseConfig struct {
+	Type        string        `yaml:"type"`
+	DSN         string        `yaml:"dsn"`
+	User        string        `yaml:"user"`
+	Password    string        `yaml:"password"`
+	Host        string        `yaml:"host"`
+	Port        int           `yaml:"port"`
+	Name        string        `yaml:"name"`
+	SSLMode     string        `yaml:"ssl_mode"`
+	Path        string        `yaml:"path"`
+	JournalMode string        `yaml:"journal_mode"`
+	BusyTimeout time.Duration `yaml:"busy_timeout"`
+}
+
+type AuthConfig struct {
+	JWTSecret    string        `yaml:"jwt_secret"`
+	TokenTimeout time.Duration `yaml:"token_timeout"`
+	MaxRefresh   time.Duration `yaml:"max_refresh"`
+}
+
+// GatewayConfig sets how often the devices are pinged and how long they can stay silent before being disconnected,
+// along with the delay the clients are asked to wait before reconnecting when the API restarts
+type GatewayConfig struct {
+	PingPeriod     time.Duration `yaml:"ping_period"`
+	PongWait       time.Duration `yaml:"pong_wait"`
+	ReconnectDelay time.Duration `yaml:"reconnect_delay"`
+}
+
+type ClusterConfig struct {
+	Backend string `yaml:"backend"`
+}
+
+type TrashConfig struct {
+	RetentionDays int `yaml:"retention_days"`
+}
+
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:           8080,
+			TrustedProxies: []string{"127.0.0.1", "::1"},
+			CORS: CORSConfig{
+				MaxAge: 12 * time.Hour,
+			},
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Path:        "db/gorm.db",
+			JournalMode: "wal",
+			BusyTimeout: 5 * time.Second,
+		},
+		Auth: AuthConfig{
+			TokenTimeout: time.Hour,
+			MaxRefresh:   31 * 24 * time.Hour,
+		},
+		Gateway: GatewayConfig{
+			PingPeriod:     2 * time.Minute,
+			PongWait:       3 * time.Minute,
+			ReconnectDelay: 5 * time.Second,
+		},
+		Cluster: ClusterConfig{
+			Backend: LocalBackend,
+		},
+		Trash: TrashConfig{
+			RetentionDays: 30,
+		},
+		Limits: limits.DefaultLimits,
+	}
+}
+
+// Load reads the configuration with the flags found at the start of the arguments, the remaining arguments are
+// returned. The configuration is not validated
+func Load(args []string) (*Config, []string, error) {
+	flags := flag.NewFlagSet("api", flag.ContinueOnError)
+	file := flags.String("config", os.Getenv("CONFIG_FILE"), "the yaml configuration file")
+	port := flags.Int("port", 0, "the port the API listens on")
+	databaseType := flags.String("db-type", "", "the database used, sqlite, mysql or postgres")
+	clusterBackend := flags.String("cluster-backend", "", "the cluster backend, local or database")
+	adminUsername := flags.String("admin-username", "", "the user given the administrator role on startup")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := Default()
+	if *file != "" {
+		err = config.readFile(*file)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	err = config.readEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			config.Server.Port = *port
+		case "db-type":
+			config.Database.Type = *databaseType
+		case "cluster-backend":
+			config.Cluster.Backend = *clusterBackend
+		case "admin-username":
+			config.AdminUsername = *adminUsername
+		}
+	})
+	return config, flags.Args(), nil
+}
+
+func (c *Config) readFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	return decoder.Decode(c)
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readEnv applies the environment variables that are set, a variable set to an empty value is ignored
+func (c *Config) readEnv() error {
+	reader := envReader{}
+	reader.int("PORT", &c.Server.Port)
+	reader.list("TRUSTED_PROXIES", &c.Server.TrustedProxies)
+	reader.list("CORS_ALLOWED_ORIGINS", &c.Server.CORS.AllowedOrigins)
+	reader.bool("CORS_ALLOW_CREDENTIALS", &c.Server.CORS.AllowCredentials)
+	reader.duration("CORS_MAX_AGE", &c.Server.CORS.MaxAge)
+	reader.duration("SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+	reader.string("DBTYPE", &c.Database.Type)
+	reader.string("DBDSN", &c.Database.DSN)
+	reader.string("DBUSER", &c.Database.User)
+	reader.string("DBPASS", &c.Database.Password)
+	reader.string("DBHOST", &c.Database.Host)
+	reader.int("DBPORT", &c.Database.Port)
+	reader.string("DBNAME", &c.Database.Name)
+	reader.string("DBSSLMODE", &c.Database.SSLMode)
+	reader.string("DBPATH", &c.Database.Path)
+	reader.string("DBJOURNALMODE", &c.Database.JournalMode)
+	reader.duration("DBBUSYTIMEOUT", &c.Database.BusyTimeout)
+	reader.string("JWT_SECRET", &c.Auth.JWTSecret)
+	reader.duration("JWT_TIMEOUT", &c.Auth.TokenTimeout)
+	reader.duration("JWT_MAX_REFRESH", &c.Auth.MaxRefresh)
+	reader.duration("GATEWAY_PING_PERIOD", &c.Gateway.PingPeriod)
+	reader.duration("GATEWAY_PONG_WAIT", &c.Gateway.PongWait)
+	reader.duration("GATEWAY_RECONNECT_DELAY", &c.Gateway.ReconnectDelay)
+	reader.string("CLUSTER_BACKEND", &c.Cluster.Backend)
+	reader.int("TRASH_RETENTION_DAYS", &c.Trash.RetentionDays)
+	reader.int("LIMIT_MAX_DEVICES", &c.Limits.MaxDevices)
+	reader.int("LIMIT_COMMANDS_PER_MINUTE", &c.Limits.CommandsPerMinute)
+	reader.int("LIMIT_MAX_WEBHOOKS", &c.Limits.MaxWebhooks)
+	reader.int("LIMIT_MAX_SCHEDULES", &c.Limits.MaxSchedules)
+	reader.string("ADMIN_USERNAME", &c.AdminUsername)
+	return reader.err
+}
+
+// envReader keeps the first variable that could not be parsed
+type envReader struct {
+	err error
+}
+
+func (r *envReader) lookup(name string) (string, bool) {
+	value := os.Getenv(name)
+	return value, value != "" && r.err == nil
+}
+
+func (r *envReader) string(name string, target *string) {
+	if value, ok := r.lookup(name); ok {
+		*target = value
+	}
+}
+
+func (r *envReader) list(name string, target *[]string) {
+	if value, ok := r.lookup(name); ok {
+		*target = make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*target = append(*target, item)
+			}
+		}
+	}
+}
+
+func (r *envReader) int(name string, target *int) {
+	if value, ok := r.lookup(name); ok {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			r.err = fmt.Errorf("%s must be an integer", name)
+			return
+		}
+		*target = parsed
+	}
+}
+
+func (r *envReader) bool(name string, target *bool) {
+	if value, ok := r.lookup(name); ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			r.err = fmt.Errorf("%s must be true or false", name)
+			return
+		}
+		*target = parsed
+	}
+}
+
+func (r *envReader) duration(name string, target *time.Duration) {
+	if value, ok := r.lookup(name); ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			r.err = fmt.Errorf("%s must be a duration such as 90s or 2h", name)
+			return
+		}
+		*target = parsed
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+const MinJWTSecretLength = 32
+
+const SqliteDatabase = "sqlite"
+const MysqlDatabase = "mysql"
+const PostgresDatabase = "postgres"
+const LocalBackend = "local"
+const DatabaseBackend = "database"
+
+// Validate checks the whole configuration, every problem found is reported
+func (c *Config) Validate() error {
+	var problems []string
+	problems = append(problems, c.Database.problems()...)
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		problems = append(problems, "the server port must be between 1 and 65535")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				problems = append(problems, fmt.Sprintf("the trusted proxy %q is not an ip address or a cidr", proxy))
+			}
+		}
+	}
+	for _, origin := range c.Server.CORS.AllowedOrigins {
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			problems = append(problems, fmt.Sprintf("the cors origin %q must be * or start with http:// or https://", origin))
+		}
+	}
+	if c.Server.CORS.MaxAge < 0 {
+		problems = append(problems, "the cors max age must not be negative")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "the shutdown timeout must be positive")
+	}
+	if len(c.Auth.JWTSecret) < MinJWTSecretLength {
+		problems = append(problems, fmt.Sprintf("the jwt secret must be at least %d characters long", MinJWTSecretLength))
+	}
+	if c.Auth.TokenTimeout <= 0 {
+		problems = append(problems, "the token timeout must be positive")
+	}
+	if c.Auth.MaxRefresh < 0 {
+		problems = append(problems, "the token max refresh must not be negative")
+	}
+	if c.Gateway.PingPeriod <= 0 {
+		problems = append(problems, "the gateway ping period must be positive")
+	}
+	if c.Gateway.PongWait <= c.Gateway.PingPeriod {
+		problems = append(problems, "the gateway pong wait must be longer than the ping period")
+	}
+	if c.Gateway.ReconnectDelay < 0 {
+		problems = append(problems, "the gateway reconnect delay must not be negative")
+	}
+	if c.Cluster.Backend != LocalBackend && c.Cluster.Backend != DatabaseBackend {
+		problems = append(problems, "the cluster backend must be local or database")
+	}
+	if c.Trash.RetentionDays < 0 {
+		problems = append(problems, "the trash retention must not be negative")
+	}
+	if c.Limits.MaxDevices < 0 || c.Limits.CommandsPerMinute < 0 || c.Limits.MaxWebhooks < 0 || c.Limits.MaxSchedules < 0 {
+		problems = append(problems, "the limits must be positive or 0 for no limit")
+	}
+	return toError(problems)
+}
+
+// Validate only checks the database settings, it is enough for the commands that do not start the API
+func (c *DatabaseConfig) Validate() error {
+	return toError(c.problems())
+}
+
+var sqliteJournalModes = []string{"delete", "truncate", "persist", "memory", "wal", "off"}
+var postgresSSLModes = []string{"", "disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// problems ignores the options replaced by the DSN, a zero port stands for the default port of the server
+func (c *DatabaseConfig) problems() []string {
+	var problems []string
+	switch c.Type {
+	case SqliteDatabase:
+		if c.DSN == "" && c.Path == "" {
+			problems = append(problems, "the sqlite database path is required")
+		}
+		if !slices.Contains(sqliteJournalModes, strings.ToLower(c.JournalMode)) {
+			problems = append(problems, "the sqlite journal mode must be one of "+strings.Join(sqliteJournalModes, ", "))
+		}
+		if c.BusyTimeout < 0 {
+			problems = append(problems, "the sqlite busy timeout must not be negative")
+		}
+	case MysqlDatabase, PostgresDatabase:
+		if c.DSN != "" {
+			return nil
+		}
+		if c.User == "" || c.Host == "" || c.Name == "" {
+			problems = append(problems, "the database user, host and name are required")
+		}
+		if c.Port < 0 || c.Port > 65535 {
+			problems = append(problems, "the database port must be between 0 and 65535")
+		}
+		if c.Type == PostgresDatabase && !slices.Contains(postgresSSLModes, c.SSLMode) {
+			problems = append(problems, "the postgres ssl mode must be one of "+strings.Join(postgresSSLModes[1:], ", "))
+		}
+	default:
+		problems = append(problems, "the database type must be sqlite, mysql or postgres")
+	}
+	return problems
+}
+
+func toError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("invalid configuration: " + strings.Join(problems, ", "))
+}
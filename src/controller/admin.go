@@ -0,0 +1,266 @@
+package controller
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-errors/errors"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/api"
+	"github.com/pc-power-api/src/controller/gateway"
+	"github.com/pc-power-api/src/controller/middleware"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/infra/repo"
+	"github.com/pc-power-api/src/pubsub"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const DefaultAdminUserLimit = 50
+const MaxAdminUserLimit = 100
+
+var CannotDisableSelf = exceptions.NewUnsupportedOperation("an administrator cannot disable their own account")
+var ChannelHasNoSession = exceptions.NewUnsupportedOperation("a channel uses the session of its relay board")
+
+// AdminHandler gives the administrators access to every account, the changes they make are written to the audit log
+// of the account concerned
+type AdminHandler struct {
+	userRepo   *repo.UserRepository
+	deviceRepo *repo.DeviceRepository
+	auditRepo  *repo.AuditRepository
+}
+
+func NewAdminHandler(e *gin.Engine, jwtMiddleware *jwt.GinJWTMiddleware, userRepo *repo.UserRepository, deviceRepo *repo.DeviceRepository, auditRepo *repo.AuditRepository) {
+	handler := &AdminHandler{
+		userRepo:   userRepo,
+		deviceRepo: deviceRepo,
+		auditRepo:  auditRepo,
+	}
+
+	group := e.Group("/admin", jwtMiddleware.MiddlewareFunc(), middleware.AdminOnly())
+	{
+		group.GET("/users", handler.getUsers)
+		group.POST("/users/:"+IdPathParam+"/disable", handler.disableUser)
+		group.POST("/users/:"+IdPathParam+"/enable", handler.enableUser)
+		group.POST("/users/:"+IdPathParam+"/reset-password", handler.resetPassword)
+		group.GET("/devices/connected", handler.getConnectedDevices)
+		group.DELETE("/devices/connected/:"+IdPathParam, handler.disconnectDevice)
+		group.GET("/audit", handler.getAuditEntries)
+		group.GET("/stats", handler.getStats)
+	}
+}
+
+func (h *AdminHandler) getUsers(c *gin.Context) {
+	var query api.AdminUserQuery
+	err := c.ShouldBindQuery(&query)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	limit := DefaultAdminUserLimit
+	if query.Limit != "" {
+		limit, _ = strconv.Atoi(query.Limit)
+		limit = min(limit, MaxAdminUserLimit)
+	}
+	offset, _ := strconv.Atoi(query.Offset)
+
+	users, total, aerr := h.userRepo.Search(query.Search, limit, offset)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	userList := api.AdminUserInfoList{
+		Users: make([]api.AdminUserInfo, 0, len(users)),
+		Total: total,
+	}
+	for i := range users {
+		userList.Users = append(userList.Users, api.AdminUserInfo{
+			ID:        users[i].ID,
+			Username:  users[i].Username,
+			Role:      users[i].Role,
+			Disabled:  users[i].Disabled,
+			Devices:   len(users[i].Devices),
+			CreatedAt: users[i].CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, userList)
+}
+
+func (h *AdminHandler) disableUser(c *gin.Context) {
+	user, aerr := h.userRepo.GetAccountById(c.Param(IdPathParam))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	if user.ID == middleware.GetUserIdFromContext(c) {
+		c.Error(errors.New(CannotDisableSelf))
+		return
+	}
+
+	aerr = h.userRepo.SetDisabled(user, true)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	gateway.NotifyAccountDisabled(user.ID)
+	h.audit(c, user.ID, "", "disable_account")
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AdminHandler) enableUser(c *gin.Context) {
+	user, aerr := h.userRepo.GetAccountById(c.Param(IdPathParam))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	aerr = h.userRepo.SetDisabled(user, false)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	h.audit(c, user.ID, "", "enable_account")
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AdminHandler) resetPassword(c *gin.Context) {
+	var data *api.PasswordResetInfo
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	user, aerr := h.userRepo.GetAccountById(c.Param(IdPathParam))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(data.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+	aerr = h.userRepo.SetPassword(user, string(hashedPassword))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	h.audit(c, user.ID, "", "reset_password")
+
+	c.Status(http.StatusNoContent)
+}
+
+// getConnectedDevices only lists the devices connected to the instance handling the request
+func (h *AdminHandler) getConnectedDevices(c *gin.Context) {
+	clients := gateway.GetConnectedDevices()
+	devices := api.ConnectedDeviceInfoList{
+		InstanceID: gateway.Cluster.InstanceID(),
+		Devices:    make([]api.ConnectedDeviceInfo, 0, len(clients)),
+	}
+	for _, client := range clients {
+		device := client.GetDevice()
+		deviceInfo := api.ConnectedDeviceInfo{
+			ID:     device.ID,
+			Name:   device.Name,
+			UserID: device.UserID,
+			Status: client.GetStatus(),
+		}
+		if device.ParentID != nil {
+			deviceInfo.ParentID = *device.ParentID
+		}
+		devices.Devices = append(devices.Devices, deviceInfo)
+	}
+	c.JSON(http.StatusOK, devices)
+}
+
+func (h *AdminHandler) disconnectDevice(c *gin.Context) {
+	device, aerr := h.deviceRepo.GetById(c.Param(IdPathParam))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	if device.ParentID != nil {
+		c.Error(errors.New(ChannelHasNoSession))
+		return
+	}
+
+	aerr = gateway.DisconnectDevice(device.ID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	h.audit(c, device.UserID, device.ID, "disconnect_device")
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AdminHandler) getAuditEntries(c *gin.Context) {
+	entries, aerr := h.auditRepo.GetByActor(entity.AdminActor)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	entriesInfo := make([]api.AdminAuditEntryInfo, 0, len(entries))
+	for _, entry := range entries {
+		entriesInfo = append(entriesInfo, api.AdminAuditEntryInfo{
+			AuditEntryInfo: api.AuditEntryInfo{
+				ID:        entry.ID,
+				CreatedAt: entry.CreatedAt,
+				DeviceID:  entry.DeviceID,
+				Actor:     entry.Actor,
+				Action:    entry.Action,
+				Details:   entry.Details,
+			},
+			UserID: entry.UserID,
+		})
+	}
+	c.JSON(http.StatusOK, entriesInfo)
+}
+
+func (h *AdminHandler) getStats(c *gin.Context) {
+	users, disabled, aerr := h.userRepo.Count()
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	devices, aerr := h.deviceRepo.Count()
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.SystemStatsInfo{
+		Users:            users,
+		DisabledUsers:    disabled,
+		Devices:          devices,
+		ConnectedDevices: len(gateway.GetConnectedDevices()),
+		Subscriptions:    pubsub.Default.SubscriptionCount(),
+	})
+}
+
+// audit records the action in the log of the account concerned, naming the administrator who made it
+func (h *AdminHandler) audit(c *gin.Context, userId string, deviceId string, action string) {
+	details := "by administrator " + middleware.GetUsernameFromContext(c)
+	aerr := h.auditRepo.Create(&entity.AuditEntry{
+		ID:       uuid.New().String(),
+		UserID:   userId,
+		DeviceID: deviceId,
+		Actor:    entity.AdminActor,
+		Action:   action,
+		Details:  details,
+	})
+	if aerr != nil {
+		log.Println(aerr.ErrorStack())
+	}
+}
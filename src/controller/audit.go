@@ -0,0 +1,43 @@
+package controller
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/pc-power-api/src/api"
+	"github.com/pc-power-api/src/controller/middleware"
+	"github.com/pc-power-api/src/infra/repo"
+	"net/http"
+)
+
+type AuditHandler struct {
+	auditRepo *repo.AuditRepository
+}
+
+func NewAuditHandler(e *gin.Engine, jwtMiddleware *jwt.GinJWTMiddleware, auditRepo *repo.AuditRepository) {
+	handler := &AuditHandler{
+		auditRepo: auditRepo,
+	}
+
+	e.GET("/user/audit", jwtMiddleware.MiddlewareFunc(), handler.getAuditEntries)
+}
+
+func (h *AuditHandler) getAuditEntries(c *gin.Context) {
+	entries, aerr := h.auditRepo.GetByUserId(middleware.GetUserIdFromContext(c))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	entriesInfo := make([]api.AuditEntryInfo, 0, len(entries))
+	for _, entry := range entries {
+		entriesInfo = append(entriesInfo, api.AuditEntryInfo{
+			ID:        entry.ID,
+			CreatedAt: entry.CreatedAt,
+			DeviceID:  entry.DeviceID,
+			Actor:     entry.Actor,
+			Action:    entry.Action,
+			Details:   entry.Details,
+		})
+	}
+	c.JSON(http.StatusOK, entriesInfo)
+}
@@ -44,6 +44,7 @@ func (h *AuthHandler) register(c *gin.Context) {
 		ID:       userUuid.String(),
 		Username: credentials.Username,
 		Password: string(hashedPassword),
+		Role:     entity.UserRole,
 	}
 
 	aerr := h.userRepo.Create(&newUser)
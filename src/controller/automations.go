@@ -0,0 +1,288 @@
+package controller
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-errors/errors"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/api"
+	"github.com/pc-power-api/src/automation"
+	"github.com/pc-power-api/src/controller/middleware"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/infra/repo"
+	"github.com/pc-power-api/src/limits"
+	"net/http"
+)
+
+var UserDoesNotOwnAutomation = exceptions.NewNoAccess("The user does not own this automation")
+
+type AutomationsHandler struct {
+	automationRepo *repo.AutomationRepository
+	userRepo       *repo.UserRepository
+	engine         *automation.Engine
+}
+
+func NewAutomationsHandler(e *gin.Engine, jwtMiddleware *jwt.GinJWTMiddleware, automationRepo *repo.AutomationRepository, userRepo *repo.UserRepository, engine *automation.Engine) {
+	handler := &AutomationsHandler{
+		automationRepo: automationRepo,
+		userRepo:       userRepo,
+		engine:         engine,
+	}
+
+	group := e.Group("/user/automations", jwtMiddleware.MiddlewareFunc())
+	{
+		group.POST("/", handler.createAutomation)
+		group.GET("/", handler.getAutomations)
+		group.POST("/dry-run", handler.dryRun)
+		group.GET("/:"+IdPathParam, handler.getAutomation)
+		group.PUT("/:"+IdPathParam, handler.updateAutomation)
+		group.DELETE("/:"+IdPathParam, handler.deleteAutomation)
+	}
+}
+
+func (h *AutomationsHandler) createAutomation(c *gin.Context) {
+	var automationInfo *api.AutomationInfo
+	err := c.ShouldBind(&automationInfo)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	ownerId := middleware.GetUserIdFromContext(c)
+	aerr := h.checkDevicesOwnership(ownerId, automationInfo)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	newAutomation := entity.Automation{
+		ID:     uuid.New().String(),
+		UserID: ownerId,
+	}
+	check := automationLimits(nil, automationInfo)
+	applyAutomationInfo(&newAutomation, automationInfo)
+	aerr = h.automationRepo.Create(&newAutomation, check)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, toAutomationInfo(&newAutomation))
+}
+
+func (h *AutomationsHandler) getAutomations(c *gin.Context) {
+	automations, aerr := h.automationRepo.GetByUserId(middleware.GetUserIdFromContext(c))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	automationsInfo := make([]api.AutomationInfo, 0, len(automations))
+	for i := range automations {
+		automationsInfo = append(automationsInfo, toAutomationInfo(&automations[i]))
+	}
+	c.JSON(http.StatusOK, automationsInfo)
+}
+
+func (h *AutomationsHandler) getAutomation(c *gin.Context) {
+	ownedAutomation, aerr := h.getOwnedAutomation(c)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, toAutomationInfo(ownedAutomation))
+}
+
+func (h *AutomationsHandler) updateAutomation(c *gin.Context) {
+	ownedAutomation, aerr := h.getOwnedAutomation(c)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	var automationInfo *api.AutomationInfo
+	err := c.ShouldBind(&automationInfo)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	aerr = h.checkDevicesOwnership(ownedAutomation.UserID, automationInfo)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	check := automationLimits(ownedAutomation, automationInfo)
+	applyAutomationInfo(ownedAutomation, automationInfo)
+	aerr = h.automationRepo.Update(ownedAutomation, check)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, toAutomationInfo(ownedAutomation))
+}
+
+func (h *AutomationsHandler) deleteAutomation(c *gin.Context) {
+	ownedAutomation, aerr := h.getOwnedAutomation(c)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	aerr = h.automationRepo.Delete(ownedAutomation)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AutomationsHandler) dryRun(c *gin.Context) {
+	var event *api.AutomationDryRunInfo
+	err := c.ShouldBind(&event)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	user, aerr := h.userRepo.GetById(middleware.GetUserIdFromContext(c))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	if event.DeviceID != "" && !user.HasDevice(event.DeviceID) {
+		c.Error(errors.New(UserDoesNotOwnDevice))
+		return
+	}
+
+	automations, aerr := h.automationRepo.GetByUserId(user.ID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	results := make([]api.AutomationDryRunResult, 0)
+	for _, match := range h.engine.DryRun(automations, event) {
+		results = append(results, api.AutomationDryRunResult{
+			AutomationID: match.ID,
+			Name:         match.Name,
+			Debounce:     match.Debounce,
+			Action:       toAutomationInfo(&match).Action,
+		})
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+func (h *AutomationsHandler) getOwnedAutomation(c *gin.Context) (*entity.Automation, *errors.Error) {
+	ownedAutomation, aerr := h.automationRepo.GetById(c.Param(IdPathParam))
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	if middleware.GetUserIdFromContext(c) != ownedAutomation.UserID {
+		return nil, errors.New(UserDoesNotOwnAutomation)
+	}
+	return ownedAutomation, nil
+}
+
+// automationLimits returns the check of the webhooks and schedules added, an automation keeping its type is already
+// counted. The repository runs it in the transaction saving the automation
+func automationLimits(previous *entity.Automation, automationInfo *api.AutomationInfo) repo.AutomationCountCheck {
+	addsWebhook := automationInfo.Action.Type == entity.WebhookAction &&
+		(previous == nil || previous.ActionType != entity.WebhookAction)
+	addsSchedule := automationInfo.Trigger.Type == entity.TimeWindowTrigger &&
+		(previous == nil || previous.TriggerType != entity.TimeWindowTrigger)
+	if !addsWebhook && !addsSchedule {
+		return nil
+	}
+
+	return func(webhooks int64, schedules int64) *errors.Error {
+		current := limits.Get()
+		if addsWebhook {
+			aerr := limits.CheckCount("webhooks", webhooks, current.MaxWebhooks)
+			if aerr != nil {
+				return aerr
+			}
+		}
+		if addsSchedule {
+			return limits.CheckCount("schedules", schedules, current.MaxSchedules)
+		}
+		return nil
+	}
+}
+
+func (h *AutomationsHandler) checkDevicesOwnership(ownerId string, automationInfo *api.AutomationInfo) *errors.Error {
+	user, aerr := h.userRepo.GetById(ownerId)
+	if aerr != nil {
+		return aerr
+	}
+
+	if automationInfo.Trigger.Type != entity.TimeWindowTrigger && !user.HasDevice(automationInfo.Trigger.DeviceID) {
+		return errors.New(UserDoesNotOwnDevice)
+	}
+	if automationInfo.Action.Type == entity.CommandAction && !user.HasDevice(automationInfo.Action.DeviceID) {
+		return errors.New(UserDoesNotOwnDevice)
+	}
+	return nil
+}
+
+func applyAutomationInfo(automation *entity.Automation, automationInfo *api.AutomationInfo) {
+	automation.Name = automationInfo.Name
+	automation.Enabled = automationInfo.Enabled
+	automation.Debounce = automationInfo.Debounce
+	automation.TriggerType = automationInfo.Trigger.Type
+	automation.TriggerDeviceID = ""
+	automation.TriggerStatus = nil
+	automation.WindowStart = ""
+	automation.WindowEnd = ""
+	if automationInfo.Trigger.Type == entity.TimeWindowTrigger {
+		automation.WindowStart = automationInfo.Trigger.WindowStart
+		automation.WindowEnd = automationInfo.Trigger.WindowEnd
+	} else {
+		automation.TriggerDeviceID = automationInfo.Trigger.DeviceID
+		automation.TriggerStatus = automationInfo.Trigger.Status
+	}
+
+	automation.ActionType = automationInfo.Action.Type
+	automation.ActionDeviceID = ""
+	automation.ActionCommand = ""
+	automation.WebhookURL = ""
+	automation.Message = automationInfo.Action.Message
+	switch automationInfo.Action.Type {
+	case entity.CommandAction:
+		automation.ActionDeviceID = automationInfo.Action.DeviceID
+		automation.ActionCommand = automationInfo.Action.Command
+	case entity.WebhookAction:
+		automation.WebhookURL = automationInfo.Action.WebhookURL
+	}
+}
+
+func toAutomationInfo(automation *entity.Automation) api.AutomationInfo {
+	return api.AutomationInfo{
+		ID:       automation.ID,
+		Name:     automation.Name,
+		Enabled:  automation.Enabled,
+		Debounce: automation.Debounce,
+		Trigger: api.AutomationTriggerInfo{
+			Type:        automation.TriggerType,
+			DeviceID:    automation.TriggerDeviceID,
+			Status:      automation.TriggerStatus,
+			WindowStart: automation.WindowStart,
+			WindowEnd:   automation.WindowEnd,
+		},
+		Action: api.AutomationActionInfo{
+			Type:       automation.ActionType,
+			DeviceID:   automation.ActionDeviceID,
+			Command:    automation.ActionCommand,
+			WebhookURL: automation.WebhookURL,
+			Message:    automation.Message,
+		},
+		LastFiredAt: automation.LastFiredAt,
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/pc-power-api/src/controller/middleware"
 	"github.com/pc-power-api/src/exceptions"
 	"github.com/pc-power-api/src/infra/repo"
+	"github.com/pc-power-api/src/limits"
 	"net/http"
 )
 
@@ -16,18 +17,21 @@ const DeviceCodeLength = 6
 const DeviceSecretLength = 16
 const IdPathParam = "id"
 
-var UserDoesNotOwnDevice = exceptions.NewNoAccess("The user does not own this device")
-var DeviceNotConnectedError = exceptions.NewDeviceUnreachable("the device is not online")
+var UserDoesNotOwnDevice = gateway.UserDoesNotOwnDeviceError
+var DeviceNotConnectedError = gateway.DeviceNotConnectedError
+var ChannelCannotConnectError = exceptions.NewNoAccess("a channel cannot open a gateway session, its relay board must be used")
 
 type DevicesHandler struct {
-	deviceRepo *repo.DeviceRepository
-	userRepo   *repo.UserRepository
+	deviceRepo    *repo.DeviceRepository
+	userRepo      *repo.UserRepository
+	wolTargetRepo *repo.WolTargetRepository
 }
 
-func NewDevicesHandler(e *gin.Engine, jwtMiddleware *jwt.GinJWTMiddleware, deviceRepo *repo.DeviceRepository, userRepo *repo.UserRepository) {
+func NewDevicesHandler(e *gin.Engine, jwtMiddleware *jwt.GinJWTMiddleware, deviceRepo *repo.DeviceRepository, userRepo *repo.UserRepository, wolTargetRepo *repo.WolTargetRepository) {
 	handler := &DevicesHandler{
-		deviceRepo: deviceRepo,
-		userRepo:   userRepo,
+		deviceRepo:    deviceRepo,
+		userRepo:      userRepo,
+		wolTargetRepo: wolTargetRepo,
 	}
 
 	group := e.Group("/devices")
@@ -35,10 +39,16 @@ func NewDevicesHandler(e *gin.Engine, jwtMiddleware *jwt.GinJWTMiddleware, devic
 		group.GET("/gateway", handler.gateway)
 		group.POST("/power-switch", jwtMiddleware.MiddlewareFunc(), handler.pressPowerSwitch)
 		group.POST("/reset-switch", jwtMiddleware.MiddlewareFunc(), handler.pressResetSwitch)
+		group.POST("/wake-on-lan", jwtMiddleware.MiddlewareFunc(), handler.wakeOnLan)
 	}
 }
 
 func (h *DevicesHandler) gateway(c *gin.Context) {
+	if aerr := gateway.CheckDraining(); aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
 	var data *api.DeviceIdentify
 	err := c.ShouldBindQuery(&data)
 	if err != nil {
@@ -52,7 +62,18 @@ func (h *DevicesHandler) gateway(c *gin.Context) {
 		return
 	}
 
-	gateway.NewDeviceClient(c.Writer, c.Request, device)
+	if device.ParentID != nil {
+		c.Error(errors.New(ChannelCannotConnectError))
+		return
+	}
+
+	channels, aerr := h.deviceRepo.GetChannels(device.ID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	gateway.NewDeviceClient(c.Writer, c.Request, device, channels)
 }
 
 func (h *DevicesHandler) pressPowerSwitch(c *gin.Context) {
@@ -74,14 +95,19 @@ func (h *DevicesHandler) pressPowerSwitch(c *gin.Context) {
 		return
 	}
 
-	if deviceClient, ok := gateway.ConnectedDevices[data.DeviceID]; ok {
-		aerr = deviceClient.PressPowerSwitch(data.Hard)
-		if aerr != nil {
-			c.Error(aerr)
-			return
-		}
-	} else {
-		c.Error(errors.New(DeviceNotConnectedError))
+	aerr = limits.AllowCommand(data.DeviceID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	command := api.PowerCommand
+	if data.Hard {
+		command = api.HardPowerOffCommand
+	}
+	aerr = gateway.SendCommand(data.DeviceID, command)
+	if aerr != nil {
+		c.Error(aerr)
 		return
 	}
 	c.Status(http.StatusNoContent)
@@ -106,14 +132,65 @@ func (h *DevicesHandler) pressResetSwitch(c *gin.Context) {
 		return
 	}
 
-	if deviceClient, ok := gateway.ConnectedDevices[data.DeviceID]; ok {
-		aerr = deviceClient.PressResetSwitch()
-		if aerr != nil {
-			c.Error(aerr)
-			return
-		}
-	} else {
-		c.Error(errors.New(DeviceNotConnectedError))
+	aerr = limits.AllowCommand(data.DeviceID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	aerr = gateway.SendCommand(data.DeviceID, api.ResetCommand)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *DevicesHandler) wakeOnLan(c *gin.Context) {
+	var data *api.WakeOnLanCommand
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	user, aerr := h.userRepo.GetById(middleware.GetUserIdFromContext(c))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	if !user.HasDevice(data.DeviceID) {
+		c.Error(errors.New(UserDoesNotOwnDevice))
+		return
+	}
+
+	aerr = limits.AllowCommand(data.DeviceID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	device, aerr := h.deviceRepo.GetById(data.DeviceID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	if !device.WolRelay {
+		c.Error(errors.New(DeviceIsNotWolRelay))
+		return
+	}
+
+	target, aerr := h.wolTargetRepo.GetByIdAndDeviceId(data.TargetID, device.ID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	aerr = gateway.SendWakeOnLan(data.DeviceID, target.MacAddress)
+	if aerr != nil {
+		c.Error(aerr)
 		return
 	}
 	c.Status(http.StatusNoContent)
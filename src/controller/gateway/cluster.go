@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/api/gateway"
+	"github.com/pc-power-api/src/cluster"
+	"github.com/pc-power-api/src/pubsub"
+	"log"
+)
+
+// Cluster is the backend locating the devices connected to the other instances, it must be set before the gateways
+// accept connections
+var Cluster cluster.Backend = cluster.NewLocalBackend()
+
+func init() {
+	cluster.RegisterEvent(gateway.DeviceStateEvent, gateway.DeviceState{})
+	cluster.RegisterEvent(gateway.AutomationNotificationEvent, gateway.AutomationNotification{})
+	cluster.RegisterEvent(gateway.DeviceCreatedEvent, gateway.DeviceCreated{})
+	cluster.RegisterEvent(gateway.DeviceUpdatedEvent, gateway.DeviceUpdated{})
+	cluster.RegisterEvent(gateway.DeviceDeletedEvent, gateway.DeviceDeleted{})
+	cluster.RegisterEvent(gateway.DeviceRevokedEvent, gateway.DeviceRevoked{})
+	cluster.RegisterEvent(gateway.AccountDeletedEvent, gateway.AccountDeleted{})
+	cluster.RegisterEvent(gateway.AccountDisabledEvent, gateway.AccountDisabled{})
+}
+
+func StartCluster(backend cluster.Backend) {
+	Cluster = backend
+	backend.Start(clusterHandler{})
+}
+
+// Publish delivers the event to the subscribers of every instance
+func Publish(topic string, data interface{}) {
+	pubsub.Publish(topic, data)
+	if err := Cluster.Broadcast(topic, data); err != nil {
+		log.Println(err.ErrorStack())
+	}
+}
+
+type clusterHandler struct{}
+
+func (h clusterHandler) HandleCommand(command cluster.Command) *errors.Error {
+	defer trackCommand()()
+	client, ok := GetConnectedDevice(command.DeviceID)
+	if !ok {
+		return errors.New(DeviceNotConnectedError)
+	}
+	return execute(client, command)
+}
+
+func (h clusterHandler) HandleEvent(topic string, data interface{}) {
+	pubsub.PublishRemote(topic, data)
+}
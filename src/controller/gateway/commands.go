@@ -0,0 +1,138 @@
+package gateway
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/api"
+	"github.com/pc-power-api/src/api/gateway"
+	"github.com/pc-power-api/src/cluster"
+	"github.com/pc-power-api/src/exceptions"
+)
+
+const wakeOnLanCommand = "wake_on_lan"
+const closeSessionCommand = "close_session"
+const attachChannelCommand = "attach_channel"
+const detachChannelCommand = "detach_channel"
+
+var DeviceNotConnectedError = exceptions.NewDeviceUnreachable("the device is not online")
+var UnknownCommandError = errors.Errorf("unknown device command")
+
+// GetConnectedDevice returns the client of a device connected to this instance
+func GetConnectedDevice(deviceId string) (*DeviceClient, bool) {
+	ConnectedDevicesMu.Lock()
+	defer ConnectedDevicesMu.Unlock()
+	client, ok := ConnectedDevices[deviceId]
+	return client, ok
+}
+
+// GetDeviceStates returns the state of the given devices whether they are connected to this instance or another one
+func GetDeviceStates(deviceIds ...string) map[string]gateway.DeviceState {
+	states := make(map[string]gateway.DeviceState, len(deviceIds))
+	remote := make([]string, 0)
+	ConnectedDevicesMu.Lock()
+	for _, deviceId := range deviceIds {
+		if client, ok := ConnectedDevices[deviceId]; ok {
+			states[deviceId] = gateway.DeviceState{ID: deviceId, Status: client.GetStatus(), Online: true}
+		} else {
+			remote = append(remote, deviceId)
+		}
+	}
+	ConnectedDevicesMu.Unlock()
+
+	located := Cluster.Locate(remote...)
+	for _, deviceId := range remote {
+		state := gateway.DeviceState{ID: deviceId}
+		if presence, ok := located[deviceId]; ok {
+			state.Status = presence.Status
+			state.Online = true
+		}
+		states[deviceId] = state
+	}
+	return states
+}
+
+// GetConnectedDevices returns the clients of the devices connected to this instance, the channels included
+func GetConnectedDevices() []*DeviceClient {
+	ConnectedDevicesMu.Lock()
+	defer ConnectedDevicesMu.Unlock()
+	clients := make([]*DeviceClient, 0, len(ConnectedDevices))
+	for _, client := range ConnectedDevices {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+func GetDeviceState(deviceId string) gateway.DeviceState {
+	return GetDeviceStates(deviceId)[deviceId]
+}
+
+// SendCommand forwards a named user command to the device, whichever instance it is connected to
+func SendCommand(deviceId string, command string) *errors.Error {
+	return dispatch(cluster.Command{
+		DeviceID: deviceId,
+		Name:     command,
+	})
+}
+
+// DisconnectDevice closes the session of a relay board or device, it is free to connect again
+func DisconnectDevice(deviceId string) *errors.Error {
+	return dispatch(cluster.Command{
+		DeviceID: deviceId,
+		Name:     closeSessionCommand,
+		Reason:   DisconnectedDescription,
+	})
+}
+
+func SendWakeOnLan(deviceId string, mac string) *errors.Error {
+	return dispatch(cluster.Command{
+		DeviceID: deviceId,
+		Name:     wakeOnLanCommand,
+		Mac:      mac,
+	})
+}
+
+// dispatch counts the outcome of the device commands, the instance holding the device does not count the ones it
+// receives from the cluster
+func dispatch(command cluster.Command) *errors.Error {
+	defer trackCommand()()
+	aerr := deliver(command)
+	countCommand(command.Name, aerr)
+	return aerr
+}
+
+func deliver(command cluster.Command) *errors.Error {
+	if client, ok := GetConnectedDevice(command.DeviceID); ok {
+		return execute(client, command)
+	}
+	presence, ok := Cluster.Locate(command.DeviceID)[command.DeviceID]
+	if !ok {
+		return errors.New(DeviceNotConnectedError)
+	}
+	return Cluster.Forward(presence, command)
+}
+
+func execute(client *DeviceClient, command cluster.Command) *errors.Error {
+	switch command.Name {
+	case api.PowerCommand:
+		return client.PressPowerSwitch(false)
+	case api.HardPowerOffCommand:
+		return client.PressPowerSwitch(true)
+	case api.ResetCommand:
+		return client.PressResetSwitch()
+	case wakeOnLanCommand:
+		return client.SendWakeOnLan(command.Mac)
+	case revokeCommand:
+		revokeCredentials(command.DeviceID, command.Secret)
+		client.revoke(command.Reason)
+		return nil
+	case closeSessionCommand:
+		client.gracefullyCloseSession(command.Reason)
+		return nil
+	case attachChannelCommand:
+		attachChannel(client.channelOf(command))
+		return nil
+	case detachChannelCommand:
+		detachChannel(client.channelOf(command))
+		return nil
+	}
+	return errors.New(UnknownCommandError)
+}
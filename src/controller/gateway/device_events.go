@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"github.com/pc-power-api/src/api/gateway"
+	"github.com/pc-power-api/src/infra/entity"
+)
+
+func NotifyDeviceCreated(device *entity.Device) {
+	Publish(device.UserID, gateway.DeviceCreated{DeviceSummary: summarize(device)})
+}
+
+func NotifyDeviceUpdated(device *entity.Device) {
+	Publish(device.UserID, gateway.DeviceUpdated{DeviceSummary: summarize(device)})
+}
+
+func NotifyDeviceDeleted(device *entity.Device) {
+	Publish(device.UserID, gateway.DeviceDeleted{ID: device.ID})
+}
+
+func summarize(device *entity.Device) gateway.DeviceSummary {
+	summary := gateway.DeviceSummary{
+		ID:         device.ID,
+		Name:       device.Name,
+		WolRelay:   device.WolRelay,
+		Channels:   device.Channels,
+		MacAddress: device.MacAddress,
+		Host:       device.Host,
+		Notes:      device.Notes,
+		Location:   device.Location,
+		Icon:       device.Icon,
+		Tags:       device.TagNames(),
+	}
+	if device.ParentID != nil {
+		channel := device.Channel
+		summary.ParentID = *device.ParentID
+		summary.Channel = &channel
+	}
+	return summary
+}
+
+// toDevice rebuilds the cached device of a user client from a summary, the snapshots are built from the cached devices
+func toDevice(summary *gateway.DeviceSummary, userId string) entity.Device {
+	device := entity.Device{
+		ID:         summary.ID,
+		Name:       summary.Name,
+		UserID:     userId,
+		WolRelay:   summary.WolRelay,
+		Channels:   summary.Channels,
+		MacAddress: summary.MacAddress,
+		Host:       summary.Host,
+		Notes:      summary.Notes,
+		Location:   summary.Location,
+		Icon:       summary.Icon,
+	}
+	device.SetTags(summary.Tags)
+	if summary.ParentID != "" {
+		parentId := summary.ParentID
+		device.ParentID = &parentId
+		device.Channel = *summary.Channel
+	}
+	return device
+}
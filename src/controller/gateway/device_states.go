@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"context"
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/api/gateway"
+	"log"
+	"sync"
+)
+
+var deviceStates = newDeviceStateQueue()
+
+// deviceStateQueue claims, releases and publishes the device states on a single goroutine. The cluster backend may
+// write to the database, queuing keeps that I/O out of ConnectedDevicesMu while preserving the order of the changes
+type deviceStateQueue struct {
+	mu       sync.Mutex
+	pending  []gateway.DeviceState
+	applying bool
+	wake     chan struct{}
+}
+
+func newDeviceStateQueue() *deviceStateQueue {
+	queue := &deviceStateQueue{
+		mu:   sync.Mutex{},
+		wake: make(chan struct{}, 1),
+	}
+	go queue.run()
+	return queue
+}
+
+func (q *deviceStateQueue) push(state gateway.DeviceState) {
+	q.mu.Lock()
+	q.pending = append(q.pending, state)
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *deviceStateQueue) run() {
+	for range q.wake {
+		for {
+			q.mu.Lock()
+			batch := q.pending
+			q.pending = nil
+			q.applying = len(batch) > 0
+			q.mu.Unlock()
+			if len(batch) == 0 {
+				break
+			}
+			for _, state := range batch {
+				applyDeviceState(state)
+			}
+		}
+	}
+}
+
+// flush waits for the queued states to be applied, it returns false when the context is done first
+func (q *deviceStateQueue) flush(ctx context.Context) bool {
+	return waitUntil(ctx, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return len(q.pending) == 0 && !q.applying
+	})
+}
+
+func applyDeviceState(state gateway.DeviceState) {
+	var err *errors.Error
+	if state.Online {
+		err = Cluster.Claim(state.ID, state.Status)
+	} else {
+		err = Cluster.Release(state.ID)
+	}
+	if err != nil {
+		log.Println(err.ErrorStack())
+	}
+	Publish(state.ID, state)
+}
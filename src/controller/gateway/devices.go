@@ -6,14 +6,16 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/pc-power-api/src/api/gateway"
+	"github.com/pc-power-api/src/cluster"
 	"github.com/pc-power-api/src/controller/middleware"
 	"github.com/pc-power-api/src/exceptions"
 	"github.com/pc-power-api/src/infra/entity"
-	"github.com/pc-power-api/src/pubsub"
 	"github.com/pc-power-api/src/util"
+	"log"
 	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,44 +24,129 @@ var FailedToCommunicateWithDeviceError = exceptions.NewDeviceUnreachable("the co
 const InvalidMessageTitle = "The message is invalid"
 const InvalidMessageDescription = "The message is not valid json or is not following the schema"
 const NewSessionOpenedDescription = "Another session has been opened, this one will be closed"
+const RevokedDescription = "The credentials of the device have been revoked"
+const DisconnectedDescription = "The session has been closed by an administrator"
 const GatewayType = "device"
-const PingPeriod = 2 * time.Minute
-const PongWait = PingPeriod + time.Minute
+
+var PingPeriod = 2 * time.Minute
+var PongWait = PingPeriod + time.Minute
 
 var ConnectedDevices = make(map[string]*DeviceClient)
 var ConnectedDevicesMu = sync.Mutex{}
 
-func addConnectedDevice(device *entity.Device, client *DeviceClient) {
+// addConnectedDevice returns false when the credentials used by the device have been revoked in the meantime
+func addConnectedDevice(device *entity.Device, client *DeviceClient) bool {
 	ConnectedDevicesMu.Lock()
 	defer ConnectedDevicesMu.Unlock()
+	if isRevoked(device) {
+		return false
+	}
 	ConnectedDevices[device.ID] = client
+	deviceConnectionsCounter.Inc()
 	notifyDeviceState(device, client.GetStatus(), true)
+	for _, channel := range client.channels {
+		ConnectedDevices[channel.device.ID] = channel
+		notifyDeviceState(channel.device, channel.GetStatus(), true)
+	}
+	return true
+}
+
+func removeConnectedDevice(client *DeviceClient) {
+	ConnectedDevicesMu.Lock()
+	defer ConnectedDevicesMu.Unlock()
+	if ConnectedDevices[client.device.ID] != client {
+		return
+	}
+	delete(ConnectedDevices, client.device.ID)
+	deviceDisconnectionsCounter.Inc()
+	notifyDeviceState(client.device, 0, false)
+	for _, channel := range client.channels {
+		delete(ConnectedDevices, channel.device.ID)
+		notifyDeviceState(channel.device, 0, false)
+	}
+}
+
+// AttachChannel makes a channel created while its board is connected reachable without a reconnection, the instance
+// holding the board is asked to do it when the board is connected to another one
+func AttachChannel(device *entity.Device) {
+	if !attachChannel(device) {
+		forwardToBoard(device, attachChannelCommand)
+	}
+}
+
+// DetachChannel makes a deleted channel unreachable, wherever its board is connected
+func DetachChannel(device *entity.Device) {
+	if !detachChannel(device) {
+		forwardToBoard(device, detachChannelCommand)
+	}
+}
+
+// attachChannel returns false when the board of the channel is not connected to this instance
+func attachChannel(device *entity.Device) bool {
+	ConnectedDevicesMu.Lock()
+	defer ConnectedDevicesMu.Unlock()
+	board, ok := ConnectedDevices[*device.ParentID]
+	if !ok {
+		return false
+	}
+	channel := board.addChannel(device)
+	ConnectedDevices[device.ID] = channel
+	notifyDeviceState(device, channel.GetStatus(), true)
+	return true
 }
 
-func removeConnectedDevice(device *entity.Device) {
+// detachChannel returns false when the board of the channel is not connected to this instance
+func detachChannel(device *entity.Device) bool {
 	ConnectedDevicesMu.Lock()
 	defer ConnectedDevicesMu.Unlock()
+	board, ok := ConnectedDevices[*device.ParentID]
+	if !ok {
+		return false
+	}
+	delete(board.channels, device.Channel)
 	delete(ConnectedDevices, device.ID)
 	notifyDeviceState(device, 0, false)
+	return true
+}
+
+func forwardToBoard(channel *entity.Device, name string) {
+	presence, ok := Cluster.Locate(*channel.ParentID)[*channel.ParentID]
+	if !ok {
+		return
+	}
+	err := Cluster.Forward(presence, cluster.Command{
+		DeviceID:  *channel.ParentID,
+		Name:      name,
+		ChannelID: channel.ID,
+		Channel:   channel.Channel,
+	})
+	if err != nil {
+		log.Println(err.ErrorStack())
+	}
 }
 
+// notifyDeviceState is cheap enough to be called while holding ConnectedDevicesMu, the state is applied asynchronously
 func notifyDeviceState(device *entity.Device, status int, online bool) {
-	deviceState := gateway.DeviceState{
+	deviceStates.push(gateway.DeviceState{
 		ID:     device.ID,
 		Status: status,
 		Online: online,
-	}
-	pubsub.Publish(device.ID, deviceState)
+	})
 }
 
+// DeviceClient is either a physical device holding a websocket or one of the channels of a relay board, in which case
+// the messages go through the socket of the board
 type DeviceClient struct {
-	conn    *websocket.Conn
-	status  int
-	device  *entity.Device
-	writeMu sync.Mutex
+	conn     *websocket.Conn
+	status   atomic.Int32
+	device   *entity.Device
+	writeMu  sync.Mutex
+	board    *DeviceClient
+	channel  *int
+	channels map[int]*DeviceClient
 }
 
-func NewDeviceClient(w http.ResponseWriter, r *http.Request, device *entity.Device) {
+func NewDeviceClient(w http.ResponseWriter, r *http.Request, device *entity.Device, channels []entity.Device) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return
@@ -68,16 +155,24 @@ func NewDeviceClient(w http.ResponseWriter, r *http.Request, device *entity.Devi
 	conn.SetPongHandler(func(string) error { conn.SetReadDeadline(time.Now().Add(PongWait)); return nil })
 
 	client := &DeviceClient{
-		conn:    conn,
-		status:  0,
-		device:  device,
-		writeMu: sync.Mutex{},
+		conn:     conn,
+		device:   device,
+		writeMu:  sync.Mutex{},
+		channels: make(map[int]*DeviceClient),
+	}
+	client.board = client
+	for i := range channels {
+		client.addChannel(&channels[i])
 	}
 	ConnectedDevicesMu.Lock()
-	if connectedDevice, ok := ConnectedDevices[device.ID]; ok {
+	connectedDevice, ok := ConnectedDevices[device.ID]
+	if ok {
 		connectedDevice.gracefullyCloseSession(NewSessionOpenedDescription)
 	}
 	ConnectedDevicesMu.Unlock()
+	if !ok {
+		closeRemoteSession(device.ID)
+	}
 
 	for { //wait for tasks to finish
 		ConnectedDevicesMu.Lock()
@@ -87,19 +182,66 @@ func NewDeviceClient(w http.ResponseWriter, r *http.Request, device *entity.Devi
 		}
 		ConnectedDevicesMu.Unlock()
 	}
-	addConnectedDevice(device, client)
+	if !addConnectedDevice(device, client) {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(RevokedCloseCode, RevokedDescription))
+		conn.Close()
+		return
+	}
 
 	go client.listen()
 	go client.sendPing()
 }
 
+// closeRemoteSession closes the previous session of a device that was connected to another instance
+func closeRemoteSession(deviceId string) {
+	presence, ok := Cluster.Locate(deviceId)[deviceId]
+	if !ok {
+		return
+	}
+	err := Cluster.Forward(presence, cluster.Command{
+		DeviceID: deviceId,
+		Name:     closeSessionCommand,
+		Reason:   NewSessionOpenedDescription,
+	})
+	if err != nil {
+		log.Println(err.ErrorStack())
+	}
+}
+
+// channelOf returns the channel of the board a command forwarded by another instance is about
+func (c *DeviceClient) channelOf(command cluster.Command) *entity.Device {
+	return &entity.Device{
+		ID:       command.ChannelID,
+		UserID:   c.device.UserID,
+		ParentID: &c.device.ID,
+		Channel:  command.Channel,
+	}
+}
+
+func (c *DeviceClient) addChannel(device *entity.Device) *DeviceClient {
+	channel := device.Channel
+	client := &DeviceClient{
+		device:  device,
+		board:   c,
+		channel: &channel,
+	}
+	c.channels[channel] = client
+	return client
+}
+
 func (c *DeviceClient) gracefullyCloseSession(reason string) {
+	c.closeSession(websocket.CloseNormalClosure, reason)
+}
+
+// closeSession asks the device to close the socket, the client is destroyed once the device answers
+func (c *DeviceClient) closeSession(code int, reason string) {
 	c.writeMu.Lock()
 	defer c.writeMu.Unlock()
 	if c.conn == nil {
 		return
 	}
-	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason))
+	c.conn.SetWriteDeadline(time.Now().Add(WriteWait))
+	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
 }
 
 func (c *DeviceClient) listen() {
@@ -121,13 +263,27 @@ func (c *DeviceClient) listen() {
 				c.handleError(errors.New(err))
 				c.destroy()
 			}
+		} else if data.Channel != nil {
+			c.updateChannelStatus(*data.Channel, data.Status)
 		} else {
-			c.status = data.Status
-			notifyDeviceState(c.device, c.status, true)
+			c.status.Store(int32(data.Status))
+			notifyDeviceState(c.device, data.Status, true)
 		}
 	}
 }
 
+func (c *DeviceClient) updateChannelStatus(index int, status int) {
+	ConnectedDevicesMu.Lock()
+	channel, ok := c.channels[index]
+	ConnectedDevicesMu.Unlock()
+	if !ok {
+		c.handleError(errors.Errorf("the channel %d is not configured", index), InvalidMessageTitle, InvalidMessageDescription)
+		return
+	}
+	channel.status.Store(int32(status))
+	notifyDeviceState(channel.device, status, true)
+}
+
 func (c *DeviceClient) sendPing() {
 	ticker := time.NewTicker(PingPeriod)
 	defer ticker.Stop()
@@ -140,6 +296,7 @@ func (c *DeviceClient) sendPing() {
 				return
 			}
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				pingFailuresCounter.Inc()
 				c.destroy()
 			}
 			c.writeMu.Unlock()
@@ -147,8 +304,12 @@ func (c *DeviceClient) sendPing() {
 	}
 }
 
+func (c *DeviceClient) GetDevice() *entity.Device {
+	return c.device
+}
+
 func (c *DeviceClient) GetStatus() int {
-	return c.status
+	return int(c.status.Load())
 }
 
 func (c *DeviceClient) destroy() {
@@ -156,7 +317,7 @@ func (c *DeviceClient) destroy() {
 		c.conn.Close()
 		c.conn = nil
 	}
-	removeConnectedDevice(c.device)
+	removeConnectedDevice(c)
 }
 
 func (c *DeviceClient) handleError(err *errors.Error, info ...string) {
@@ -180,38 +341,47 @@ func (c *DeviceClient) handleError(err *errors.Error, info ...string) {
 	message.SetTitle(errorTitle)
 	message.SetDescription(errorDescription)
 	c.conn.WriteJSON(message)
+	messageErrorsCounter.WithLabelValues(GatewayType).Inc()
 	util.LogWebsocketError(err, id, c.conn, GatewayType)
 }
 
 func (c *DeviceClient) PressPowerSwitch(hardPowerOff bool) *errors.Error {
-	c.writeMu.Lock()
-	defer c.writeMu.Unlock()
 	var op int
 	if hardPowerOff {
 		op = gateway.HardPowerOffOpcode
 	} else {
 		op = gateway.PressPowerSwitchOpcode
 	}
-	message := gateway.CommandMessage{
+	return c.send(gateway.CommandMessage{
 		Opcode: op,
-	}
-	err := c.conn.WriteJSON(message)
-	if err != nil {
-		c.destroy()
-		return errors.New(FailedToCommunicateWithDeviceError)
-	}
-	return nil
+	})
+}
+
+func (c *DeviceClient) SendWakeOnLan(mac string) *errors.Error {
+	return c.send(gateway.CommandMessage{
+		Opcode: gateway.WakeOnLanOpcode,
+		Mac:    mac,
+	})
 }
 
 func (c *DeviceClient) PressResetSwitch() *errors.Error {
-	c.writeMu.Lock()
-	defer c.writeMu.Unlock()
-	message := gateway.CommandMessage{
+	return c.send(gateway.CommandMessage{
 		Opcode: gateway.PressResetSwitchOpcode,
+	})
+}
+
+// send writes the command on the socket of the board, with the channel index when the client is a channel
+func (c *DeviceClient) send(message gateway.CommandMessage) *errors.Error {
+	board := c.board
+	board.writeMu.Lock()
+	defer board.writeMu.Unlock()
+	if board.conn == nil {
+		return errors.New(FailedToCommunicateWithDeviceError)
 	}
-	err := c.conn.WriteJSON(message)
+	message.Channel = c.channel
+	err := board.conn.WriteJSON(message)
 	if err != nil {
-		c.destroy()
+		board.destroy()
 		return errors.New(FailedToCommunicateWithDeviceError)
 	}
 	return nil
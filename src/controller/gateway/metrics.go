@@ -0,0 +1,86 @@
+package gateway
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/api"
+	"github.com/pc-power-api/src/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const CommandSentOutcome = "sent"
+const CommandFailedOutcome = "failed"
+const CommandNotConnectedOutcome = "not_connected"
+
+// opcodeNames names the device commands after the opcode they are sent with, the other commands only manage the
+// sessions and are not counted
+var opcodeNames = map[string]string{
+	api.PowerCommand:        "press_power_switch",
+	api.ResetCommand:        "press_reset_switch",
+	api.HardPowerOffCommand: "hard_power_off",
+	wakeOnLanCommand:        "wake_on_lan",
+}
+
+var connectedDevicesGauge = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "gateway",
+	Name:      "connected_devices",
+	Help:      "Devices connected to this instance, the channels of the relay boards included.",
+}, func() float64 { return float64(len(GetConnectedDevices())) })
+
+var userSessionsGauge = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "gateway",
+	Name:      "user_sessions",
+	Help:      "User websockets and event streams connected to this instance.",
+}, func() float64 { return float64(CountUserSessions()) })
+
+var commandsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "gateway",
+	Name:      "commands_total",
+	Help:      "Commands sent to the devices from this instance, directly or through the cluster, by opcode and outcome.",
+}, []string{"opcode", "outcome"})
+
+var deviceConnectionsCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "gateway",
+	Name:      "device_connections_total",
+	Help:      "Device sockets opened on this instance.",
+})
+
+var deviceDisconnectionsCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "gateway",
+	Name:      "device_disconnections_total",
+	Help:      "Device sockets closed on this instance.",
+})
+
+var pingFailuresCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "gateway",
+	Name:      "ping_failures_total",
+	Help:      "Pings that could not be written to a device socket.",
+})
+
+var messageErrorsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "gateway",
+	Name:      "message_errors_total",
+	Help:      "Errors reported on the sockets by gateway type.",
+}, []string{"gateway"})
+
+func countCommand(command string, aerr *errors.Error) {
+	name, ok := opcodeNames[command]
+	if !ok {
+		return
+	}
+	outcome := CommandSentOutcome
+	if aerr != nil {
+		outcome = CommandFailedOutcome
+		if errors.Is(aerr, DeviceNotConnectedError) {
+			outcome = CommandNotConnectedOutcome
+		}
+	}
+	commandsCounter.WithLabelValues(name, outcome).Inc()
+}
@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/pc-power-api/src/api/gateway"
+	"github.com/pc-power-api/src/cluster"
+	"github.com/pc-power-api/src/infra/entity"
+	"log"
+	"sync"
+	"time"
+)
+
+// RevokedCloseCode is sent to a device whose credentials are no longer valid, it should not try to reconnect
+const RevokedCloseCode = 4003
+const RevocationTTL = 10 * time.Minute
+
+const revokeCommand = "revoke"
+
+type revocation struct {
+	secret    string
+	revokedAt time.Time
+}
+
+var revocations = make(map[string]revocation)
+var revocationsMu = sync.Mutex{}
+
+// RevokeDevice closes the session of a device, wherever it is connected, and refuses the connections made with its
+// current credentials. The credentials are remembered for a while to catch the connections authenticated just before
+// the revocation, the database rejects them afterward
+func RevokeDevice(device *entity.Device, reason string) {
+	revokeCredentials(device.ID, device.Secret)
+	if device.ParentID != nil {
+		DetachChannel(device)
+	} else if client, ok := GetConnectedDevice(device.ID); ok {
+		client.revoke(reason)
+	} else if presence, ok := Cluster.Locate(device.ID)[device.ID]; ok {
+		err := Cluster.Forward(presence, cluster.Command{
+			DeviceID: device.ID,
+			Name:     revokeCommand,
+			Secret:   device.Secret,
+			Reason:   reason,
+		})
+		if err != nil {
+			log.Println(err.ErrorStack())
+		}
+	}
+	Publish(device.UserID, gateway.DeviceRevoked{
+		ID:     device.ID,
+		Reason: reason,
+	})
+}
+
+// NotifyAccountDeleted closes the user sessions of a deleted account
+func NotifyAccountDeleted(userId string) {
+	Publish(userId, gateway.AccountDeleted{ID: userId})
+}
+
+// NotifyAccountDisabled closes the user sessions of a disabled account
+func NotifyAccountDisabled(userId string) {
+	Publish(userId, gateway.AccountDisabled{ID: userId})
+}
+
+func revokeCredentials(deviceId string, secret string) {
+	revocationsMu.Lock()
+	defer revocationsMu.Unlock()
+	now := time.Now()
+	for id, revoked := range revocations {
+		if now.Sub(revoked.revokedAt) > RevocationTTL {
+			delete(revocations, id)
+		}
+	}
+	revocations[deviceId] = revocation{
+		secret:    secret,
+		revokedAt: now,
+	}
+}
+
+func isRevoked(device *entity.Device) bool {
+	revocationsMu.Lock()
+	defer revocationsMu.Unlock()
+	revoked, ok := revocations[device.ID]
+	return ok && revoked.secret == device.Secret && time.Since(revoked.revokedAt) <= RevocationTTL
+}
+
+// revoke closes the socket right away, the device is removed from the connected ones before the listener notices
+func (c *DeviceClient) revoke(reason string) {
+	c.writeMu.Lock()
+	if c.conn != nil {
+		c.conn.SetWriteDeadline(time.Now().Add(WriteWait))
+		c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(RevokedCloseCode, reason))
+		c.conn.Close()
+	}
+	c.writeMu.Unlock()
+	removeConnectedDevice(c)
+}
@@ -0,0 +1,83 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/gorilla/websocket"
+	"github.com/pc-power-api/src/exceptions"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+const RestartingDescription = "The server is restarting, reconnect in %d seconds"
+const DrainPollPeriod = 50 * time.Millisecond
+
+var draining atomic.Bool
+var reconnectDelay time.Duration
+var inFlightCommands atomic.Int64
+
+func IsDraining() bool {
+	return draining.Load()
+}
+
+// CheckDraining refuses the new sessions once the API is shutting down
+func CheckDraining() *errors.Error {
+	if !IsDraining() {
+		return nil
+	}
+	return errors.New(exceptions.NewServiceUnavailable("the server is shutting down", reconnectDelay))
+}
+
+// Drain waits for the commands being sent to finish then closes every session with a close frame telling the clients
+// when to reconnect. The devices still connected once the context is done are disconnected without waiting for them
+func Drain(ctx context.Context, delay time.Duration) {
+	reconnectDelay = delay
+	draining.Store(true)
+	waitUntil(ctx, func() bool { return inFlightCommands.Load() == 0 })
+
+	reason := fmt.Sprintf(RestartingDescription, int(math.Ceil(delay.Seconds())))
+	userSubscribersMu.Lock()
+	for subscriber := range userSubscribers {
+		go subscriber.close(websocket.CloseServiceRestart, reason)
+	}
+	userSubscribersMu.Unlock()
+	for _, client := range GetConnectedDevices() {
+		if client.board == client {
+			go client.closeSession(websocket.CloseServiceRestart, reason)
+		}
+	}
+
+	drained := waitUntil(ctx, func() bool {
+		return CountUserSessions() == 0 && len(GetConnectedDevices()) == 0
+	})
+	if !drained {
+		for _, client := range GetConnectedDevices() {
+			if client.board == client {
+				client.destroy()
+			}
+		}
+	}
+	deviceStates.flush(ctx)
+}
+
+// trackCommand counts a command as in flight until the returned function is called
+func trackCommand() func() {
+	inFlightCommands.Add(1)
+	return func() { inFlightCommands.Add(-1) }
+}
+
+// waitUntil returns false when the context is done before the condition is met
+func waitUntil(ctx context.Context, condition func() bool) bool {
+	ticker := time.NewTicker(DrainPollPeriod)
+	defer ticker.Stop()
+	for !condition() {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
@@ -1,8 +1,35 @@
 package gateway
 
-import "github.com/gorilla/websocket"
+import (
+	"github.com/gorilla/websocket"
+	"github.com/pc-power-api/src/controller/middleware"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var allowedOrigins []string
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	CheckOrigin:     checkOrigin,
+}
+
+// Configure sets the keep-alive of the device sessions and the origins allowed to open a session from a browser
+func Configure(pingPeriod time.Duration, pongWait time.Duration, origins []string) {
+	PingPeriod = pingPeriod
+	PongWait = pongWait
+	allowedOrigins = origins
+}
+
+// checkOrigin accepts the requests made from the same host as well as the origins allowed by the cors settings
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || middleware.IsOriginAllowed(allowedOrigins, origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
 }
@@ -0,0 +1,109 @@
+package gateway
+
+import (
+	"github.com/gin-contrib/sse"
+	"github.com/gorilla/websocket"
+	"github.com/pc-power-api/src/api/gateway"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/pubsub"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const HeartbeatPeriod = 15 * time.Second
+const HeartbeatEvent = "heartbeat"
+const EventStreamBufferSize = pubsub.HistorySize + 64
+
+// ServeUserEvents streams the same events as the user websocket using server-sent events, it returns once the client
+// is gone or could not keep up with the events
+func ServeUserEvents(w http.ResponseWriter, r *http.Request, user *entity.User, since string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// The buffer holds a whole replay, the subscription disconnects the stream once it is full for too long
+	events := make(chan gateway.UserEvent, EventStreamBufferSize)
+	done := make(chan struct{})
+	defer close(done)
+	closing := make(chan struct{})
+	closingOnce := sync.Once{}
+	var closed gateway.StreamClosed
+	subscriber := newUserSubscriber(user, func(event gateway.UserEvent) {
+		select {
+		case events <- event:
+		case <-done:
+		}
+	}, func(code int, reason string) {
+		closingOnce.Do(func() {
+			closed = gateway.StreamClosed{Code: code, Reason: reason}
+			close(closing)
+		})
+	})
+
+	header := w.Header()
+	header.Set("Content-Type", sse.ContentType)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	subscriber.start(since)
+	defer subscriber.stop()
+
+	ticker := time.NewTicker(HeartbeatPeriod)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-closing:
+			// The events queued before the stream got closed are still written, the last one may explain why
+			for len(events) > 0 {
+				if encodeUserEvent(w, <-events) != nil {
+					break
+				}
+			}
+			encodeStreamClosed(w, closed)
+			flusher.Flush()
+			return
+		case event := <-events:
+			err = encodeUserEvent(w, event)
+		case now := <-ticker.C:
+			err = sse.Encode(w, sse.Event{
+				Event: HeartbeatEvent,
+				Data:  now.Unix(),
+			})
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func encodeUserEvent(w http.ResponseWriter, event gateway.UserEvent) error {
+	return sse.Encode(w, sse.Event{
+		Id:    event.Cursor,
+		Event: event.Type,
+		Data:  event.Data,
+	})
+}
+
+// encodeStreamClosed tells the client why the stream ends, along with the delay before reconnecting when the server
+// is restarting
+func encodeStreamClosed(w http.ResponseWriter, closed gateway.StreamClosed) error {
+	var retry uint
+	if closed.Code == websocket.CloseServiceRestart {
+		retry = uint(reconnectDelay.Milliseconds())
+	}
+	return sse.Encode(w, sse.Event{
+		Event: gateway.StreamClosedEvent,
+		Retry: retry,
+		Data:  closed,
+	})
+}
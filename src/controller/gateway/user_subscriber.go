@@ -0,0 +1,231 @@
+package gateway
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/pc-power-api/src/api/gateway"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/pubsub"
+	"sync"
+)
+
+// userSubscriber filters the published events for a user and hands them to a transport. The events are queued until
+// the client has caught up with either a snapshot of its devices or the events it missed since its last connection.
+// The transport is closed when it cannot keep up with the events or when the account is deleted or disabled
+type userSubscriber struct {
+	user         *entity.User
+	send         func(event gateway.UserEvent)
+	close        func(code int, reason string)
+	subscription *pubsub.Subscription
+	queueMu      sync.Mutex
+	ready        bool
+	pending      []pubsub.Event
+	lastSeq      uint64
+}
+
+var userSubscribers = make(map[*userSubscriber]struct{})
+var userSubscribersMu = sync.Mutex{}
+
+// CountUserSessions returns the number of user websockets and event streams connected to this instance
+func CountUserSessions() int {
+	userSubscribersMu.Lock()
+	defer userSubscribersMu.Unlock()
+	return len(userSubscribers)
+}
+
+func addUserSubscriber(subscriber *userSubscriber) {
+	userSubscribersMu.Lock()
+	defer userSubscribersMu.Unlock()
+	userSubscribers[subscriber] = struct{}{}
+}
+
+func removeUserSubscriber(subscriber *userSubscriber) {
+	userSubscribersMu.Lock()
+	defer userSubscribersMu.Unlock()
+	delete(userSubscribers, subscriber)
+}
+
+func newUserSubscriber(user *entity.User, send func(event gateway.UserEvent), close func(code int, reason string)) *userSubscriber {
+	return &userSubscriber{
+		user:    user,
+		send:    send,
+		close:   close,
+		queueMu: sync.Mutex{},
+	}
+}
+
+func (s *userSubscriber) start(since string) {
+	topics := make([]string, 0, len(s.user.Devices)+1)
+	topics = append(topics, s.user.ID)
+	for _, device := range s.user.Devices {
+		topics = append(topics, device.ID)
+	}
+	s.subscription = pubsub.Subscribe(s, pubsub.SubscriptionOptions{
+		Policy: pubsub.DisconnectPolicy,
+		OnDisconnect: func() {
+			s.close(websocket.ClosePolicyViolation, SlowConsumerDescription)
+		},
+	}, topics...)
+	addUserSubscriber(s)
+	s.catchUp(since)
+}
+
+func (s *userSubscriber) stop() {
+	removeUserSubscriber(s)
+	if s.subscription != nil {
+		s.subscription.Close()
+	}
+}
+
+// catchUp replays the events missed since the cursor, a snapshot is sent instead when the cursor comes from another
+// instance or from before a restart since the sequence numbers are not shared
+func (s *userSubscriber) catchUp(since string) {
+	var events []pubsub.Event
+	var seq uint64
+	replay := false
+	if since != "" {
+		events, seq, replay = pubsub.SinceCursor(since)
+	}
+	var snapshot gateway.UserEvent
+	if !replay {
+		snapshot = s.buildSnapshot()
+	}
+
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	if replay {
+		s.lastSeq = seq
+		for _, event := range events {
+			s.deliver(event)
+		}
+	} else {
+		s.lastSeq = snapshot.Seq
+		s.emit(snapshot)
+	}
+	for _, event := range s.pending {
+		if event.Seq > s.lastSeq {
+			s.deliver(event)
+		}
+	}
+	s.pending = nil
+	s.ready = true
+}
+
+func (s *userSubscriber) buildSnapshot() gateway.UserEvent {
+	seq := pubsub.LastSequence()
+	deviceIds := make([]string, 0, len(s.user.Devices))
+	for _, device := range s.user.Devices {
+		deviceIds = append(deviceIds, device.ID)
+	}
+	states := GetDeviceStates(deviceIds...)
+	snapshot := gateway.Snapshot{
+		Devices: make([]gateway.SnapshotDevice, 0, len(deviceIds)),
+	}
+	for i := range s.user.Devices {
+		device := &s.user.Devices[i]
+		snapshot.Devices = append(snapshot.Devices, gateway.SnapshotDevice{
+			DeviceSummary: summarize(device),
+			Status:        states[device.ID].Status,
+			Online:        states[device.ID].Online,
+		})
+	}
+	return gateway.UserEvent{
+		Seq:  seq,
+		Type: gateway.SnapshotEvent,
+		Data: snapshot,
+	}
+}
+
+func (s *userSubscriber) Notify(event pubsub.Event) {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	if !s.ready {
+		s.pending = append(s.pending, event)
+		return
+	}
+	s.deliver(event)
+}
+
+func (s *userSubscriber) deliver(event pubsub.Event) {
+	s.lastSeq = event.Seq
+	if event.Topic == s.user.ID {
+		switch data := event.Data.(type) {
+		case gateway.DeviceCreated:
+			if !s.user.HasDevice(data.ID) {
+				s.user.Devices = append(s.user.Devices, toDevice(&data.DeviceSummary, s.user.ID))
+				s.subscription.AddTopics(data.ID)
+			}
+			s.emit(gateway.UserEvent{
+				Seq:  event.Seq,
+				Type: gateway.DeviceCreatedEvent,
+				Data: data,
+			})
+		case gateway.DeviceUpdated:
+			for i := range s.user.Devices {
+				if s.user.Devices[i].ID == data.ID {
+					s.user.Devices[i] = toDevice(&data.DeviceSummary, s.user.ID)
+				}
+			}
+			s.emit(gateway.UserEvent{
+				Seq:  event.Seq,
+				Type: gateway.DeviceUpdatedEvent,
+				Data: data,
+			})
+		case gateway.DeviceDeleted:
+			s.removeDevice(data.ID)
+			s.emit(gateway.UserEvent{
+				Seq:  event.Seq,
+				Type: gateway.DeviceDeletedEvent,
+				Data: data,
+			})
+		case gateway.DeviceRevoked:
+			s.emit(gateway.UserEvent{
+				Seq:  event.Seq,
+				Type: gateway.DeviceRevokedEvent,
+				Data: data,
+			})
+		case gateway.AccountDeleted:
+			s.emit(gateway.UserEvent{
+				Seq:  event.Seq,
+				Type: gateway.AccountDeletedEvent,
+				Data: data,
+			})
+			go s.close(websocket.CloseNormalClosure, AccountDeletedDescription)
+		case gateway.AccountDisabled:
+			s.emit(gateway.UserEvent{
+				Seq:  event.Seq,
+				Type: gateway.AccountDisabledEvent,
+				Data: data,
+			})
+			go s.close(websocket.CloseNormalClosure, AccountDisabledDescription)
+		case gateway.AutomationNotification:
+			s.emit(gateway.UserEvent{
+				Seq:  event.Seq,
+				Type: gateway.AutomationNotificationEvent,
+				Data: data,
+			})
+		}
+	} else if state, ok := event.Data.(gateway.DeviceState); ok && s.user.HasDevice(event.Topic) {
+		s.emit(gateway.UserEvent{
+			Seq:  event.Seq,
+			Type: gateway.DeviceStateEvent,
+			Data: state,
+		})
+	}
+}
+
+// emit hands the event to the transport along with the cursor to resume from
+func (s *userSubscriber) emit(event gateway.UserEvent) {
+	event.Cursor = pubsub.Cursor(event.Seq)
+	s.send(event)
+}
+
+// removeDevice stops the delivery of the events of a deleted device
+func (s *userSubscriber) removeDevice(deviceId string) {
+	for i := range s.user.Devices {
+		if s.user.Devices[i].ID == deviceId {
+			s.user.Devices = append(s.user.Devices[:i], s.user.Devices[i+1:]...)
+			break
+		}
+	}
+	s.subscription.RemoveTopics(deviceId)
+}
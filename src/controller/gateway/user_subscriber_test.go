@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"github.com/pc-power-api/src/api/gateway"
+	"github.com/pc-power-api/src/infra/entity"
+	"slices"
+	"testing"
+)
+
+func TestSnapshotDescribesTheDevices(t *testing.T) {
+	boardId := "board"
+	user := &entity.User{ID: "alice", Devices: []entity.Device{
+		{
+			ID:         boardId,
+			Name:       "Relay board",
+			UserID:     "alice",
+			Channels:   4,
+			MacAddress: "00:11:22:33:44:55",
+			Host:       "192.168.1.20",
+			Notes:      "in the attic",
+			Location:   "attic",
+			Icon:       "board",
+		},
+		{ID: "channel", Name: "Desktop", UserID: "alice", ParentID: &boardId, Channel: 2},
+	}}
+	user.Devices[0].SetTags([]string{"home", "rack"})
+
+	var events []gateway.UserEvent
+	subscriber := newUserSubscriber(user, func(event gateway.UserEvent) {
+		events = append(events, event)
+	}, func(code int, reason string) {})
+	subscriber.start("")
+	defer subscriber.stop()
+
+	if len(events) != 1 || events[0].Type != gateway.SnapshotEvent || events[0].Cursor == "" {
+		t.Fatalf("expected a snapshot, got %+v", events)
+	}
+	snapshot := events[0].Data.(gateway.Snapshot)
+	if len(snapshot.Devices) != 2 {
+		t.Fatalf("expected the 2 devices of the user, got %+v", snapshot.Devices)
+	}
+	board := snapshot.Devices[0]
+	if board.ID != boardId || board.Name != "Relay board" || board.Channels != 4 || board.MacAddress != "00:11:22:33:44:55" ||
+		board.Host != "192.168.1.20" || board.Notes != "in the attic" || board.Location != "attic" || board.Icon != "board" ||
+		!slices.Equal(board.Tags, []string{"home", "rack"}) || board.Online {
+		t.Fatalf("the board is not fully described %+v", board)
+	}
+	channel := snapshot.Devices[1]
+	if channel.Name != "Desktop" || channel.ParentID != boardId || channel.Channel == nil || *channel.Channel != 2 {
+		t.Fatalf("the channel is not fully described %+v", channel)
+	}
+}
@@ -1,58 +1,200 @@
 package gateway
 
 import (
+	"encoding/json"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-errors/errors"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/pc-power-api/src/api"
+	"github.com/pc-power-api/src/api/gateway"
+	"github.com/pc-power-api/src/controller/middleware"
+	"github.com/pc-power-api/src/exceptions"
 	"github.com/pc-power-api/src/infra/entity"
-	"github.com/pc-power-api/src/pubsub"
+	"github.com/pc-power-api/src/infra/repo"
+	"github.com/pc-power-api/src/limits"
+	"github.com/pc-power-api/src/util"
 	"net/http"
+	"sync"
+	"time"
 )
 
+const UserGatewayType = "user"
+const WriteWait = 10 * time.Second
+const SlowConsumerDescription = "The client is not reading the events fast enough"
+const AccountDeletedDescription = "The account has been deleted"
+const AccountDisabledDescription = "The account has been disabled"
+
+var UserDoesNotOwnDeviceError = exceptions.NewNoAccess("The user does not own this device")
+
+// UserClient is closed from the subscriber, the drain and the revocations while its socket is being read, the
+// connection is never released and every write, the close frame included, is done under writeMu
 type UserClient struct {
-	conn *websocket.Conn
-	user *entity.User
+	conn       *websocket.Conn
+	user       *entity.User
+	userRepo   *repo.UserRepository
+	writeMu    sync.Mutex
+	closed     bool
+	subscriber *userSubscriber
 }
 
-func NewUserClient(w http.ResponseWriter, r *http.Request, user *entity.User) {
+func NewUserClient(w http.ResponseWriter, r *http.Request, user *entity.User, userRepo *repo.UserRepository, since string) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return
 	}
 
 	client := &UserClient{
-		conn: conn,
-		user: user,
+		conn:     conn,
+		user:     user,
+		userRepo: userRepo,
+		writeMu:  sync.Mutex{},
 	}
-	pubsub.Subscribe(client)
+	client.subscriber = newUserSubscriber(user, func(event gateway.UserEvent) {
+		client.write(event)
+	}, client.close)
+	client.subscriber.start(since)
 	conn.SetCloseHandler(func(code int, text string) error {
-		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, text))
-		client.destroy()
+		client.close(code, text)
 		return nil
 	})
-	go client.listen()
+	go client.listen(conn)
 }
 
-// Messages need to be read for the CloseHandler to be called
-func (c *UserClient) listen() {
-	for c.conn != nil {
-		_, _, err := c.conn.ReadMessage()
+// Messages need to be read for the CloseHandler to be called. The read fails once the connection is closed by another
+// goroutine, which ends the loop
+func (c *UserClient) listen(conn *websocket.Conn) {
+	for {
+		var data gateway.UserMessage
+		err := conn.ReadJSON(&data)
 		if err != nil {
+			var jsonTypeError *json.UnmarshalTypeError
+			var jsonSyntaxError *json.SyntaxError
+			if errors.As(err, &jsonTypeError) || errors.As(err, &jsonSyntaxError) {
+				c.handleError("", errors.New(err), InvalidMessageTitle, InvalidMessageDescription)
+				continue
+			}
 			c.destroy()
+			return
+		}
+
+		err = binding.Validator.ValidateStruct(&data)
+		if err != nil {
+			c.handleError(data.RequestID, errors.New(err), InvalidMessageTitle, InvalidMessageDescription)
+			continue
 		}
+
+		aerr := c.executeCommand(&data)
+		if aerr != nil {
+			c.handleError(data.RequestID, aerr)
+			continue
+		}
+		c.write(gateway.UserResponse{
+			RequestID: data.RequestID,
+			Success:   true,
+		})
 	}
 }
 
+func (c *UserClient) executeCommand(message *gateway.UserMessage) *errors.Error {
+	user, aerr := c.userRepo.GetById(c.user.ID)
+	if aerr != nil {
+		return aerr
+	}
+
+	if !user.HasDevice(message.DeviceID) {
+		return errors.New(UserDoesNotOwnDeviceError)
+	}
+
+	aerr = limits.AllowCommand(message.DeviceID)
+	if aerr != nil {
+		return aerr
+	}
+
+	command := message.Action
+	if command == api.PowerCommand && message.Args.Hard {
+		command = api.HardPowerOffCommand
+	}
+	return SendCommand(message.DeviceID, command)
+}
+
 func (c *UserClient) destroy() {
-	pubsub.Unsubscribe(c)
-	if c.conn != nil {
+	c.subscriber.stop()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if !c.closed {
+		c.closed = true
 		c.conn.Close()
-		c.conn = nil
 	}
 }
 
-func (c *UserClient) Notify(topic string, data interface{}) {
-	if topic == c.user.ID {
-		c.user.Devices = append(c.user.Devices, data.(entity.Device))
-	} else if c.user.HasDevice(topic) {
-		c.conn.WriteJSON(data)
+// close sends a close frame before destroying the client
+func (c *UserClient) close(code int, reason string) {
+	c.writeMu.Lock()
+	if !c.closed {
+		c.conn.SetWriteDeadline(time.Now().Add(WriteWait))
+		c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+	}
+	c.writeMu.Unlock()
+	c.destroy()
+}
+
+func (c *UserClient) write(data interface{}) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(WriteWait))
+	c.conn.WriteJSON(data)
+}
+
+// handleError reports the error on the socket, the title and description are deduced from the error when not given
+func (c *UserClient) handleError(requestId string, err *errors.Error, info ...string) {
+	id := uuid.New()
+	errorTitle, errorDescription, errorMsg := describeError(err)
+	if len(info) > 0 {
+		errorTitle = info[0]
+		errorDescription = info[1]
+		errorMsg = err.Error()
+	}
+	message := gateway.ErrorMessage{}
+	message.SetRequestId(requestId)
+	message.SetId(id.String())
+	message.SetMessage(errorMsg)
+	message.SetTitle(errorTitle)
+	message.SetDescription(errorDescription)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return
+	}
+	c.conn.WriteJSON(message)
+	messageErrorsCounter.WithLabelValues(UserGatewayType).Inc()
+	util.LogWebsocketError(err, id, c.conn, UserGatewayType)
+}
+
+func describeError(err *errors.Error) (string, string, string) {
+	var deviceUnreachableError *exceptions.DeviceUnreachable
+	if errors.As(err, &deviceUnreachableError) {
+		return middleware.DeviceUnreachableTitle, middleware.DeviceUnreachableDescription, err.Error()
+	}
+	var objectNotFoundError *exceptions.ObjectNotFound
+	if errors.As(err, &objectNotFoundError) {
+		return middleware.ObjectNotFoundTitle, middleware.ObjectNotFoundDescription, err.Error()
+	}
+	var noAccessError *exceptions.NoAccess
+	if errors.As(err, &noAccessError) {
+		return middleware.NoAccessTitle, middleware.NoAccessDescription, err.Error()
+	}
+	var limitExceededError *exceptions.LimitExceeded
+	if errors.As(err, &limitExceededError) {
+		return middleware.LimitExceededTitle, middleware.LimitExceededDescription, err.Error()
+	}
+	var serviceUnavailableError *exceptions.ServiceUnavailable
+	if errors.As(err, &serviceUnavailableError) {
+		return middleware.ServiceUnavailableTitle, middleware.ServiceUnavailableDescription, err.Error()
 	}
+	return middleware.UnexpectedErrorTitle, middleware.UnexpectedErrorDescription, ""
 }
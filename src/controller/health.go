@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"context"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/pc-power-api/src/api"
+	"github.com/pc-power-api/src/controller/gateway"
+	"github.com/pc-power-api/src/infra/migration"
+	"github.com/pc-power-api/src/infra/repo"
+	"github.com/pc-power-api/src/pubsub"
+	"github.com/pc-power-api/src/version"
+	"net/http"
+	"time"
+)
+
+const ReadinessTimeout = 2 * time.Second
+const CheckPassed = "ok"
+
+// HealthHandler answers the probes of the orchestrator, the probes do not need to be authenticated
+type HealthHandler struct {
+	healthRepo *repo.HealthRepository
+	migrator   *migration.Migrator
+	startedAt  time.Time
+}
+
+func NewHealthHandler(e *gin.Engine, jwtMiddleware *jwt.GinJWTMiddleware, healthRepo *repo.HealthRepository, migrator *migration.Migrator) {
+	handler := &HealthHandler{
+		healthRepo: healthRepo,
+		migrator:   migrator,
+		startedAt:  time.Now(),
+	}
+
+	e.GET("/healthz", handler.getHealth)
+	e.GET("/readyz", handler.getReadiness)
+	e.GET("/status", jwtMiddleware.MiddlewareFunc(), handler.getStatus)
+}
+
+func (h *HealthHandler) getHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, api.HealthInfo{
+		Status: CheckPassed,
+	})
+}
+
+// getReadiness runs every check even when one fails so that the response tells everything that is wrong
+func (h *HealthHandler) getReadiness(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), ReadinessTimeout)
+	defer cancel()
+
+	readiness := api.ReadinessInfo{
+		Ready: true,
+		Checks: map[string]string{
+			"database":   CheckPassed,
+			"migrations": CheckPassed,
+			"draining":   CheckPassed,
+		},
+	}
+	fail := func(check string, reason string) {
+		readiness.Ready = false
+		readiness.Checks[check] = reason
+	}
+	if aerr := h.healthRepo.Ping(ctx); aerr != nil {
+		fail("database", aerr.Error())
+		fail("migrations", "the database is unreachable")
+	} else if aerr := h.migrator.Check(ctx); aerr != nil {
+		fail("migrations", aerr.Error())
+	}
+	if gateway.IsDraining() {
+		fail("draining", "the server is shutting down")
+	}
+
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, readiness)
+}
+
+func (h *HealthHandler) getStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, api.StatusInfo{
+		InstanceID:       gateway.Cluster.InstanceID(),
+		Version:          version.Get(),
+		StartedAt:        h.startedAt,
+		Uptime:           int64(time.Since(h.startedAt).Seconds()),
+		Draining:         gateway.IsDraining(),
+		ConnectedDevices: len(gateway.GetConnectedDevices()),
+		UserSessions:     gateway.CountUserSessions(),
+		Subscriptions:    pubsub.Default.SubscriptionCount(),
+	})
+}
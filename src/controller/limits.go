@@ -0,0 +1,54 @@
+package controller
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/api"
+	"github.com/pc-power-api/src/controller/middleware"
+	"github.com/pc-power-api/src/infra/repo"
+	"github.com/pc-power-api/src/limits"
+	"net/http"
+)
+
+type LimitsHandler struct {
+	deviceRepo     *repo.DeviceRepository
+	automationRepo *repo.AutomationRepository
+}
+
+func NewLimitsHandler(e *gin.Engine, jwtMiddleware *jwt.GinJWTMiddleware, deviceRepo *repo.DeviceRepository, automationRepo *repo.AutomationRepository) {
+	handler := &LimitsHandler{
+		deviceRepo:     deviceRepo,
+		automationRepo: automationRepo,
+	}
+
+	e.GET("/user/limits", jwtMiddleware.MiddlewareFunc(), handler.getLimits)
+}
+
+func (h *LimitsHandler) getLimits(c *gin.Context) {
+	userId := middleware.GetUserIdFromContext(c)
+	devices, aerr := h.deviceRepo.CountByUserId(userId)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	webhooks, schedules, aerr := h.automationRepo.CountByUserId(userId)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	current := limits.Get()
+	c.JSON(http.StatusOK, api.LimitsInfo{
+		Devices:           api.UsageInfo{Used: devices, Limit: current.MaxDevices},
+		Webhooks:          api.UsageInfo{Used: webhooks, Limit: current.MaxWebhooks},
+		Schedules:         api.UsageInfo{Used: schedules, Limit: current.MaxSchedules},
+		CommandsPerMinute: current.CommandsPerMinute,
+	})
+}
+
+// checkDeviceLimit fails when the user owning the given number of devices cannot own one more, the repositories run
+// it in the transaction adding the device
+func checkDeviceLimit(count int64) *errors.Error {
+	return limits.CheckCount("devices", count, limits.Get().MaxDevices)
+}
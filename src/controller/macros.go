@@ -0,0 +1,246 @@
+package controller
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-errors/errors"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/api"
+	"github.com/pc-power-api/src/controller/middleware"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/infra/repo"
+	"github.com/pc-power-api/src/macro"
+	"net/http"
+)
+
+var UserDoesNotOwnMacro = exceptions.NewNoAccess("The user does not own this macro")
+
+type MacrosHandler struct {
+	macroRepo *repo.MacroRepository
+	userRepo  *repo.UserRepository
+	runner    *macro.Runner
+}
+
+func NewMacrosHandler(e *gin.Engine, jwtMiddleware *jwt.GinJWTMiddleware, macroRepo *repo.MacroRepository, userRepo *repo.UserRepository, runner *macro.Runner) {
+	handler := &MacrosHandler{
+		macroRepo: macroRepo,
+		userRepo:  userRepo,
+		runner:    runner,
+	}
+
+	group := e.Group("/user/macros", jwtMiddleware.MiddlewareFunc())
+	{
+		group.POST("/", handler.createMacro)
+		group.GET("/", handler.getMacros)
+		group.GET("/runs/:"+IdPathParam, handler.getRun)
+		group.GET("/:"+IdPathParam, handler.getMacro)
+		group.PUT("/:"+IdPathParam, handler.updateMacro)
+		group.DELETE("/:"+IdPathParam, handler.deleteMacro)
+		group.POST("/:"+IdPathParam+"/run", handler.runMacro)
+	}
+}
+
+func (h *MacrosHandler) createMacro(c *gin.Context) {
+	var macroInfo *api.MacroInfo
+	err := c.ShouldBind(&macroInfo)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	ownerId := middleware.GetUserIdFromContext(c)
+	newMacro := entity.Macro{
+		ID:     uuid.New().String(),
+		UserID: ownerId,
+	}
+	applyMacroInfo(&newMacro, macroInfo)
+	aerr := h.checkDevicesOwnership(ownerId, &newMacro)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	aerr = h.macroRepo.Create(&newMacro)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, toMacroInfo(&newMacro))
+}
+
+func (h *MacrosHandler) getMacros(c *gin.Context) {
+	macros, aerr := h.macroRepo.GetByUserId(middleware.GetUserIdFromContext(c))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	macrosInfo := make([]api.MacroInfo, 0, len(macros))
+	for i := range macros {
+		macrosInfo = append(macrosInfo, toMacroInfo(&macros[i]))
+	}
+	c.JSON(http.StatusOK, macrosInfo)
+}
+
+func (h *MacrosHandler) getMacro(c *gin.Context) {
+	ownedMacro, aerr := h.getOwnedMacro(c)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, toMacroInfo(ownedMacro))
+}
+
+func (h *MacrosHandler) updateMacro(c *gin.Context) {
+	ownedMacro, aerr := h.getOwnedMacro(c)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	var macroInfo *api.MacroInfo
+	err := c.ShouldBind(&macroInfo)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	applyMacroInfo(ownedMacro, macroInfo)
+	aerr = h.checkDevicesOwnership(ownedMacro.UserID, ownedMacro)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	aerr = h.macroRepo.Update(ownedMacro)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, toMacroInfo(ownedMacro))
+}
+
+func (h *MacrosHandler) deleteMacro(c *gin.Context) {
+	ownedMacro, aerr := h.getOwnedMacro(c)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	aerr = h.macroRepo.Delete(ownedMacro)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *MacrosHandler) runMacro(c *gin.Context) {
+	ownedMacro, aerr := h.getOwnedMacro(c)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	aerr = h.checkDevicesOwnership(ownedMacro.UserID, ownedMacro)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	run, aerr := h.runner.Start(ownedMacro)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	c.JSON(http.StatusAccepted, run.Snapshot())
+}
+
+func (h *MacrosHandler) getRun(c *gin.Context) {
+	run, aerr := h.runner.GetRun(c.Param(IdPathParam))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	if middleware.GetUserIdFromContext(c) != run.UserID {
+		c.Error(errors.New(UserDoesNotOwnMacro))
+		return
+	}
+
+	c.JSON(http.StatusOK, run.Snapshot())
+}
+
+func (h *MacrosHandler) getOwnedMacro(c *gin.Context) (*entity.Macro, *errors.Error) {
+	ownedMacro, aerr := h.macroRepo.GetById(c.Param(IdPathParam))
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	if middleware.GetUserIdFromContext(c) != ownedMacro.UserID {
+		return nil, errors.New(UserDoesNotOwnMacro)
+	}
+	return ownedMacro, nil
+}
+
+func (h *MacrosHandler) checkDevicesOwnership(ownerId string, ownedMacro *entity.Macro) *errors.Error {
+	user, aerr := h.userRepo.GetById(ownerId)
+	if aerr != nil {
+		return aerr
+	}
+
+	for _, step := range ownedMacro.Steps {
+		if step.Type != entity.DelayStep && !user.HasDevice(step.DeviceID) {
+			return errors.New(UserDoesNotOwnDevice)
+		}
+	}
+	return nil
+}
+
+func applyMacroInfo(target *entity.Macro, macroInfo *api.MacroInfo) {
+	target.Name = macroInfo.Name
+	target.Steps = make([]entity.MacroStep, 0, len(macroInfo.Steps))
+	for i, step := range macroInfo.Steps {
+		macroStep := entity.MacroStep{
+			MacroID:  target.ID,
+			Position: i,
+			Type:     step.Type,
+		}
+		switch step.Type {
+		case entity.CommandStep:
+			macroStep.DeviceID = step.DeviceID
+			macroStep.Command = step.Command
+		case entity.WaitStateStep:
+			macroStep.DeviceID = step.DeviceID
+			macroStep.Status = step.Status
+			macroStep.Timeout = step.Timeout
+		case entity.DelayStep:
+			macroStep.Duration = step.Duration
+		}
+		target.Steps = append(target.Steps, macroStep)
+	}
+}
+
+func toMacroInfo(source *entity.Macro) api.MacroInfo {
+	steps := make([]api.MacroStepInfo, 0, len(source.Steps))
+	for _, step := range source.Steps {
+		steps = append(steps, api.MacroStepInfo{
+			Type:     step.Type,
+			DeviceID: step.DeviceID,
+			Command:  step.Command,
+			Status:   step.Status,
+			Timeout:  step.Timeout,
+			Duration: step.Duration,
+		})
+	}
+	return api.MacroInfo{
+		ID:    source.ID,
+		Name:  source.Name,
+		Steps: steps,
+	}
+}
@@ -0,0 +1,11 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// NewMetricsHandler exposes the metrics to prometheus, like the probes they do not need to be authenticated
+func NewMetricsHandler(e *gin.Engine) {
+	e.GET("/metrics", gin.WrapH(promhttp.Handler()))
+}
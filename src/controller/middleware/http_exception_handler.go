@@ -9,7 +9,10 @@ import (
 	"github.com/pc-power-api/src/api"
 	"github.com/pc-power-api/src/exceptions"
 	"github.com/pc-power-api/src/util"
+	"math"
 	"net/http"
+	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -23,8 +26,16 @@ const ObjectNotFoundTitle string = "Object not found"
 const ObjectNotFoundDescription string = "The object requested was not found on the server"
 const NoAccessTitle string = "No access"
 const NoAccessDescription string = "The user does not have access to this resource"
+const ObjectAlreadyExistTitle string = "Object already exist"
+const ObjectAlreadyExistDescription string = "The object conflicts with one that already exists on the server"
 const ValidationErrorTitle string = "Validation error"
 const ValidationErrorDescription string = "The input provided is invalid"
+const UnsupportedOperationTitle string = "Unsupported operation"
+const UnsupportedOperationDescription string = "The device does not support this operation"
+const LimitExceededTitle string = "Limit exceeded"
+const LimitExceededDescription string = "The limits of the account do not allow this operation"
+const ServiceUnavailableTitle string = "Service unavailable"
+const ServiceUnavailableDescription string = "The server is restarting, try again later"
 
 func ExceptionHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -52,11 +63,31 @@ func ExceptionHandler() gin.HandlerFunc {
 			handleObjectNotFound(c, id, err.Error())
 			return
 		}
+		var objectAlreadyExistError *exceptions.ObjectAlreadyExist
+		if errors.As(err, &objectAlreadyExistError) {
+			handleObjectAlreadyExist(c, id, err.Error())
+			return
+		}
 		var noAccessError *exceptions.NoAccess
 		if errors.As(err, &noAccessError) {
 			handleNoAccess(c, id, err.Error())
 			return
 		}
+		var unsupportedOperationError *exceptions.UnsupportedOperation
+		if errors.As(err, &unsupportedOperationError) {
+			handleUnsupportedOperation(c, id, err.Error())
+			return
+		}
+		var limitExceededError *exceptions.LimitExceeded
+		if errors.As(err, &limitExceededError) {
+			handleLimitExceeded(c, id, limitExceededError)
+			return
+		}
+		var serviceUnavailableError *exceptions.ServiceUnavailable
+		if errors.As(err, &serviceUnavailableError) {
+			handleServiceUnavailable(c, id, serviceUnavailableError)
+			return
+		}
 		var validationError validator.ValidationErrors
 		if errors.As(err, &validationError) {
 			handleValidationErrors(c, id, validationError)
@@ -113,6 +144,18 @@ func handleObjectNotFound(c *gin.Context, id uuid.UUID, message string) {
 	c.AbortWithStatusJSON(http.StatusNotFound, err)
 }
 
+func handleObjectAlreadyExist(c *gin.Context, id uuid.UUID, message string) {
+	var err api.ErrorResponse
+
+	err.SetId(id.String())
+	err.SetTitle(ObjectAlreadyExistTitle)
+	err.SetStatus(http.StatusConflict)
+	err.SetDescription(ObjectAlreadyExistDescription)
+	err.SetMessage(message)
+	err.SetExpected(true)
+	c.AbortWithStatusJSON(http.StatusConflict, err)
+}
+
 func handleNoAccess(c *gin.Context, id uuid.UUID, message string) {
 	var err api.ErrorResponse
 
@@ -125,6 +168,49 @@ func handleNoAccess(c *gin.Context, id uuid.UUID, message string) {
 	c.AbortWithStatusJSON(http.StatusForbidden, err)
 }
 
+func handleUnsupportedOperation(c *gin.Context, id uuid.UUID, message string) {
+	var err api.ErrorResponse
+
+	err.SetId(id.String())
+	err.SetTitle(UnsupportedOperationTitle)
+	err.SetStatus(http.StatusBadRequest)
+	err.SetDescription(UnsupportedOperationDescription)
+	err.SetMessage(message)
+	err.SetExpected(true)
+	c.AbortWithStatusJSON(http.StatusBadRequest, err)
+}
+
+// handleLimitExceeded tells when to retry if the limit is a rate, a quota is only lifted by removing items
+func handleLimitExceeded(c *gin.Context, id uuid.UUID, limitExceeded *exceptions.LimitExceeded) {
+	var err api.ErrorResponse
+
+	status := http.StatusForbidden
+	if limitExceeded.RetryAfter > 0 {
+		status = http.StatusTooManyRequests
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(limitExceeded.RetryAfter.Seconds()))))
+	}
+	err.SetId(id.String())
+	err.SetTitle(LimitExceededTitle)
+	err.SetStatus(status)
+	err.SetDescription(LimitExceededDescription)
+	err.SetMessage(limitExceeded.Error())
+	err.SetExpected(true)
+	c.AbortWithStatusJSON(status, err)
+}
+
+func handleServiceUnavailable(c *gin.Context, id uuid.UUID, serviceUnavailable *exceptions.ServiceUnavailable) {
+	var err api.ErrorResponse
+
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(serviceUnavailable.RetryAfter.Seconds()))))
+	err.SetId(id.String())
+	err.SetTitle(ServiceUnavailableTitle)
+	err.SetStatus(http.StatusServiceUnavailable)
+	err.SetDescription(ServiceUnavailableDescription)
+	err.SetMessage(serviceUnavailable.Error())
+	err.SetExpected(true)
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, err)
+}
+
 func handleValidationErrors(c *gin.Context, id uuid.UUID, validationErrors validator.ValidationErrors) {
 	var err api.ErrorResponse
 
@@ -141,7 +227,7 @@ func translateValidationErrors(validationErrors validator.ValidationErrors) []st
 	var translatedErrors []string
 	for _, validationError := range validationErrors {
 		translatedError := validationError.Error()
-		switch validationError.Tag() {
+		switch validationTag(validationError) {
 		case "required":
 			translatedError = validationError.Field() + " is required"
 		case "len":
@@ -149,9 +235,13 @@ func translateValidationErrors(validationErrors validator.ValidationErrors) []st
 		case "uuid":
 			translatedError = validationError.Field() + " must be a valid uuid"
 		case "max":
-			translatedError = validationError.Field() + " must be at most " + validationError.Param() + " characters long"
+			translatedError = validationError.Field() + " must be at most " + validationError.Param() + lengthUnit(validationError)
 		case "min":
-			translatedError = validationError.Field() + " must be at least " + validationError.Param() + " characters long"
+			translatedError = validationError.Field() + " must be at least " + validationError.Param() + lengthUnit(validationError)
+		case "gte":
+			translatedError = validationError.Field() + " must be greater than or equal to " + validationError.Param()
+		case "lte":
+			translatedError = validationError.Field() + " must be less than or equal to " + validationError.Param()
 		case "eqfield":
 			translatedError = validationError.Field() + " must be equal to " + validationError.Param()
 		case "excludesall":
@@ -162,6 +252,20 @@ func translateValidationErrors(validationErrors validator.ValidationErrors) []st
 			}
 		case "printascii":
 			translatedError = validationError.Field() + " must only contain printable ascii characters"
+		case "required_if", "required_unless", "required_without":
+			translatedError = validationError.Field() + " is required when " + requiredCondition(validationError)
+		case "datetime":
+			translatedError = validationError.Field() + " must follow the " + validationError.Param() + " format"
+		case "number":
+			translatedError = validationError.Field() + " must be a positive integer"
+		case "mac48":
+			translatedError = validationError.Field() + " must be a valid mac address of 6 bytes"
+		case "hostname_rfc1123|ip":
+			translatedError = validationError.Field() + " must be a valid hostname or ip address"
+		case "unique":
+			translatedError = validationError.Field() + " must not contain duplicates"
+		case "url":
+			translatedError = validationError.Field() + " must be a valid url"
 		case "oneof":
 			translatedError = validationError.Field() + " must be one of " + strings.Replace(validationError.Param(), " ", ", ", -1)
 		}
@@ -169,3 +273,31 @@ func translateValidationErrors(validationErrors validator.ValidationErrors) []st
 	}
 	return translatedErrors
 }
+
+// validationTag returns the name of the failed tag, the eq=| prefix allowing the optional fields to be cleared with an
+// empty value is left out
+func validationTag(validationError validator.FieldError) string {
+	tag := strings.TrimPrefix(validationError.Tag(), "eq=|")
+	return strings.SplitN(tag, "=", 2)[0]
+}
+
+func lengthUnit(validationError validator.FieldError) string {
+	switch validationError.Kind() {
+	case reflect.String:
+		return " characters long"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return " items long"
+	}
+	return ""
+}
+
+func requiredCondition(validationError validator.FieldError) string {
+	params := strings.SplitN(validationError.Param(), " ", 2)
+	switch validationError.Tag() {
+	case "required_if":
+		return params[0] + " is " + params[1]
+	case "required_unless":
+		return params[0] + " is not " + params[1]
+	}
+	return params[0] + " is missing"
+}
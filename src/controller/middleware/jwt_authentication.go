@@ -3,15 +3,22 @@ package middleware
 import (
 	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
+	"github.com/go-errors/errors"
 	"github.com/pc-power-api/src/api"
+	"github.com/pc-power-api/src/config"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
 	"github.com/pc-power-api/src/infra/repo"
 	"golang.org/x/crypto/bcrypt"
 	"log"
-	"os"
 	"time"
 )
 
 const Realm = "PcPowerApi"
+const RoleKey = "role"
+
+var AccountDisabledError = errors.Errorf("the account has been disabled")
+var UserIsNotAdmin = exceptions.NewNoAccess("the user is not an administrator")
 
 type JwtUser struct {
 	ID       string
@@ -20,11 +27,13 @@ type JwtUser struct {
 
 type AuthenticationMiddleware struct {
 	userRepository *repo.UserRepository
+	config         config.AuthConfig
 }
 
-func NewAuthenticationMiddleware(userRepository *repo.UserRepository) *AuthenticationMiddleware {
+func NewAuthenticationMiddleware(userRepository *repo.UserRepository, config config.AuthConfig) *AuthenticationMiddleware {
 	return &AuthenticationMiddleware{
 		userRepository: userRepository,
+		config:         config,
 	}
 }
 
@@ -44,14 +53,15 @@ func (a *AuthenticationMiddleware) AuthMiddleware() (gin.HandlerFunc, *jwt.GinJW
 func (a *AuthenticationMiddleware) initAuthSecurity() *jwt.GinJWTMiddleware {
 	return &jwt.GinJWTMiddleware{
 		Realm:      Realm,
-		Key:        []byte(os.Getenv("JWT_SECRET")),
-		Timeout:    time.Hour,
-		MaxRefresh: time.Hour * 24 * 31,
+		Key:        []byte(a.config.JWTSecret),
+		Timeout:    a.config.TokenTimeout,
+		MaxRefresh: a.config.MaxRefresh,
 
 		Authenticator:   a.authenticator(),
 		Unauthorized:    a.unauthorized(),
 		PayloadFunc:     a.payloadFunc(),
 		IdentityHandler: a.identityHandler(),
+		Authorizator:    a.authorizator(),
 		TokenLookup:     "header: Authorization, query: token, cookie: jwt",
 		TokenHeadName:   "Bearer",
 		TimeFunc:        time.Now,
@@ -68,6 +78,9 @@ func (a *AuthenticationMiddleware) authenticator() func(c *gin.Context) (interfa
 		user, aerr := a.userRepository.GetByUsername(credentials.Username)
 
 		if (aerr == nil) && (bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(credentials.Password)) == nil) {
+			if user.Disabled {
+				return nil, AccountDisabledError
+			}
 			return &JwtUser{
 				ID:       user.ID,
 				Username: user.Username,
@@ -113,9 +126,45 @@ func (a *AuthenticationMiddleware) identityHandler() func(c *gin.Context) interf
 	}
 }
 
+// authorizator rejects the tokens of the accounts deleted or disabled since they were issued, the role of the user is
+// kept in the context for the handlers restricted to administrators
+func (a *AuthenticationMiddleware) authorizator() func(data interface{}, c *gin.Context) bool {
+	return func(data interface{}, c *gin.Context) bool {
+		jwtUser, ok := data.(*JwtUser)
+		if !ok {
+			return false
+		}
+		user, aerr := a.userRepository.GetAccountById(jwtUser.ID)
+		if aerr != nil || user.Disabled {
+			return false
+		}
+		c.Set(RoleKey, user.Role)
+		return true
+	}
+}
+
+// AdminOnly must be used after the jwt middleware
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString(RoleKey) != entity.AdminRole {
+			c.Error(errors.New(UserIsNotAdmin))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 func GetUserIdFromContext(c *gin.Context) string {
 	if jwtUser, ok := c.Get(jwt.IdentityKey); ok {
 		return jwtUser.(*JwtUser).ID
 	}
 	return ""
 }
+
+func GetUsernameFromContext(c *gin.Context) string {
+	if jwtUser, ok := c.Get(jwt.IdentityKey); ok {
+		return jwtUser.(*JwtUser).Username
+	}
+	return ""
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pc-power-api/src/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"strconv"
+	"time"
+)
+
+// UnmatchedRoute labels the requests that did not match any route so that unknown paths do not create new series
+const UnmatchedRoute = "unmatched"
+
+var requestsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "http",
+	Name:      "requests_total",
+	Help:      "HTTP requests by method, route and status.",
+}, []string{"method", "route", "status"})
+
+var requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "http",
+	Name:      "request_duration_seconds",
+	Help:      "Time taken to answer the HTTP requests by method and route, the event streams last as long as they are open.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method", "route"})
+
+// Metrics records the requests under the pattern of their route rather than their path
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = UnmatchedRoute
+		}
+		requestsCounter.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		requestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,239 @@
+package controller
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-errors/errors"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/api"
+	apigateway "github.com/pc-power-api/src/api/gateway"
+	"github.com/pc-power-api/src/controller/gateway"
+	"github.com/pc-power-api/src/controller/middleware"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/infra/repo"
+	"github.com/pc-power-api/src/util"
+	"net/http"
+	"time"
+)
+
+// TransferTTL is the time given to the recipient to accept a transfer
+const TransferTTL = 24 * time.Hour
+
+var ChannelCannotBeTransferred = exceptions.NewUnsupportedOperation("a channel is transferred along with its relay board")
+var CannotTransferToSelf = exceptions.NewUnsupportedOperation("the device already belongs to this user")
+var UserIsNotRecipient = exceptions.NewNoAccess("The user is not the recipient of this transfer")
+
+type TransfersHandler struct {
+	userRepo     *repo.UserRepository
+	deviceRepo   *repo.DeviceRepository
+	transferRepo *repo.TransferRepository
+}
+
+func NewTransfersHandler(e *gin.Engine, jwtMiddleware *jwt.GinJWTMiddleware, userRepo *repo.UserRepository, deviceRepo *repo.DeviceRepository, transferRepo *repo.TransferRepository) {
+	handler := &TransfersHandler{
+		userRepo:     userRepo,
+		deviceRepo:   deviceRepo,
+		transferRepo: transferRepo,
+	}
+
+	group := e.Group("/user", jwtMiddleware.MiddlewareFunc())
+	{
+		group.POST("/devices/:"+IdPathParam+"/transfer", handler.createTransfer)
+		group.DELETE("/devices/:"+IdPathParam+"/transfer", handler.cancelTransfer)
+		group.GET("/transfers", handler.getTransfers)
+		group.POST("/transfers/:"+IdPathParam+"/accept", handler.acceptTransfer)
+		group.POST("/transfers/:"+IdPathParam+"/decline", handler.declineTransfer)
+	}
+}
+
+func (h *TransfersHandler) createTransfer(c *gin.Context) {
+	device, aerr := h.deviceRepo.GetById(c.Param(IdPathParam))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	ownerId := middleware.GetUserIdFromContext(c)
+	if ownerId != device.UserID {
+		c.Error(errors.New(UserDoesNotOwnDevice))
+		return
+	}
+
+	if device.ParentID != nil {
+		c.Error(errors.New(ChannelCannotBeTransferred))
+		return
+	}
+
+	var transferInfo *api.TransferCreateInfo
+	err := c.ShouldBind(&transferInfo)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	recipient, aerr := h.userRepo.GetByUsername(transferInfo.Username)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	if recipient.ID == ownerId {
+		c.Error(errors.New(CannotTransferToSelf))
+		return
+	}
+
+	now := time.Now()
+	transfer := entity.DeviceTransfer{
+		ID:                 uuid.New().String(),
+		CreatedAt:          now,
+		ExpiresAt:          now.Add(TransferTTL),
+		DeviceID:           device.ID,
+		FromUserID:         ownerId,
+		ToUserID:           recipient.ID,
+		ClearConfiguration: transferInfo.ClearConfiguration,
+	}
+	aerr = h.transferRepo.Create(&transfer)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, h.toTransferInfo(&transfer))
+}
+
+func (h *TransfersHandler) cancelTransfer(c *gin.Context) {
+	transfer, aerr := h.transferRepo.GetByDeviceId(c.Param(IdPathParam))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	if middleware.GetUserIdFromContext(c) != transfer.FromUserID {
+		c.Error(errors.New(UserDoesNotOwnDevice))
+		return
+	}
+
+	aerr = h.transferRepo.Delete(transfer)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *TransfersHandler) getTransfers(c *gin.Context) {
+	userId := middleware.GetUserIdFromContext(c)
+	incoming, aerr := h.transferRepo.GetIncoming(userId)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	outgoing, aerr := h.transferRepo.GetOutgoing(userId)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	transfers := api.TransferInfoList{
+		Incoming: make([]api.TransferInfo, 0, len(incoming)),
+		Outgoing: make([]api.TransferInfo, 0, len(outgoing)),
+	}
+	for i := range incoming {
+		transfers.Incoming = append(transfers.Incoming, h.toTransferInfo(&incoming[i]))
+	}
+	for i := range outgoing {
+		transfers.Outgoing = append(transfers.Outgoing, h.toTransferInfo(&outgoing[i]))
+	}
+	c.JSON(http.StatusOK, transfers)
+}
+
+// acceptTransfer moves the device to the recipient with a new secret, the previous owner may still know the old one
+func (h *TransfersHandler) acceptTransfer(c *gin.Context) {
+	transfer, aerr := h.transferRepo.GetById(c.Param(IdPathParam))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	if middleware.GetUserIdFromContext(c) != transfer.ToUserID {
+		c.Error(errors.New(UserIsNotRecipient))
+		return
+	}
+
+	device, aerr := h.deviceRepo.GetById(transfer.DeviceID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	channels, aerr := h.deviceRepo.GetChannels(device.ID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	secret := util.GenerateRandomString(DeviceSecretLength)
+	aerr = h.transferRepo.Accept(transfer, secret, checkDeviceLimit)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	gateway.RevokeDevice(device, apigateway.DeviceTransferredReason)
+	for i := range channels {
+		gateway.NotifyDeviceDeleted(&channels[i])
+	}
+	gateway.NotifyDeviceDeleted(device)
+
+	device.UserID = transfer.ToUserID
+	device.Secret = secret
+	gateway.NotifyDeviceCreated(device)
+	for i := range channels {
+		channels[i].UserID = transfer.ToUserID
+		gateway.NotifyDeviceCreated(&channels[i])
+	}
+
+	c.JSON(http.StatusOK, toDeviceInfo(device, 0, false))
+}
+
+func (h *TransfersHandler) declineTransfer(c *gin.Context) {
+	transfer, aerr := h.transferRepo.GetById(c.Param(IdPathParam))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	if middleware.GetUserIdFromContext(c) != transfer.ToUserID {
+		c.Error(errors.New(UserIsNotRecipient))
+		return
+	}
+
+	aerr = h.transferRepo.Delete(transfer)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// toTransferInfo resolves the names shown to the users, a name that cannot be found is left empty
+func (h *TransfersHandler) toTransferInfo(transfer *entity.DeviceTransfer) api.TransferInfo {
+	transferInfo := api.TransferInfo{
+		ID:                 transfer.ID,
+		DeviceID:           transfer.DeviceID,
+		ClearConfiguration: transfer.ClearConfiguration,
+		CreatedAt:          transfer.CreatedAt,
+		ExpiresAt:          transfer.ExpiresAt,
+	}
+	if device, aerr := h.deviceRepo.GetById(transfer.DeviceID); aerr == nil {
+		transferInfo.DeviceName = device.Name
+	}
+	if from, aerr := h.userRepo.GetById(transfer.FromUserID); aerr == nil {
+		transferInfo.From = from.Username
+	}
+	if to, aerr := h.userRepo.GetById(transfer.ToUserID); aerr == nil {
+		transferInfo.To = to.Username
+	}
+	return transferInfo
+}
@@ -6,15 +6,25 @@ import (
 	"github.com/go-errors/errors"
 	"github.com/google/uuid"
 	"github.com/pc-power-api/src/api"
+	apigateway "github.com/pc-power-api/src/api/gateway"
 	"github.com/pc-power-api/src/controller/gateway"
 	"github.com/pc-power-api/src/controller/middleware"
+	"github.com/pc-power-api/src/exceptions"
 	"github.com/pc-power-api/src/infra/entity"
 	"github.com/pc-power-api/src/infra/repo"
-	"github.com/pc-power-api/src/pubsub"
 	"github.com/pc-power-api/src/util"
+	"golang.org/x/crypto/bcrypt"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
+const MaxDeviceLimit = 100
+
+var DeviceIsNotRelayBoard = exceptions.NewUnsupportedOperation("the device is not a relay board")
+var ChannelHasNoCredentials = exceptions.NewUnsupportedOperation("a channel uses the credentials of its relay board")
+var IncorrectPassword = exceptions.NewNoAccess("the password is incorrect")
+
 type UsersHandler struct {
 	userRepo   *repo.UserRepository
 	deviceRepo *repo.DeviceRepository
@@ -29,30 +39,124 @@ func NewUsersHandler(e *gin.Engine, jwtMiddleware *jwt.GinJWTMiddleware, userRep
 	group := e.Group("/user", jwtMiddleware.MiddlewareFunc())
 	{
 		group.GET("/gateway", handler.gateway)
+		group.GET("/events", handler.events)
+		group.DELETE("", handler.deleteAccount)
 
 		deviceGroup := group.Group("/devices")
 
 		deviceGroup.POST("/", handler.createDevice)
 		deviceGroup.GET("/", handler.getDevices)
+		deviceGroup.GET("/trash", handler.getTrash)
+		deviceGroup.DELETE("/trash/:"+IdPathParam, handler.purgeDevice)
 		deviceGroup.GET("/:"+IdPathParam, handler.getDevice)
 		deviceGroup.PUT("/:"+IdPathParam, handler.updateDevice)
+		deviceGroup.PATCH("/:"+IdPathParam, handler.patchDevice)
 		deviceGroup.DELETE("/:"+IdPathParam, handler.deleteDevice)
+		deviceGroup.POST("/:"+IdPathParam+"/channels", handler.createChannel)
+		deviceGroup.POST("/:"+IdPathParam+"/rotate-secret", handler.rotateSecret)
+		deviceGroup.POST("/:"+IdPathParam+"/restore", handler.restoreDevice)
 	}
 }
 
 func (h *UsersHandler) gateway(c *gin.Context) {
-	user, err := h.userRepo.GetById(middleware.GetUserIdFromContext(c))
+	if aerr := gateway.CheckDraining(); aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	var query api.UserGatewayQuery
+	err := c.ShouldBindQuery(&query)
 	if err != nil {
-		c.Error(err)
+		c.Error(errors.New(err))
 		return
 	}
 
-	gateway.NewUserClient(c.Writer, c.Request, user)
+	user, aerr := h.userRepo.GetById(middleware.GetUserIdFromContext(c))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	gateway.NewUserClient(c.Writer, c.Request, user, h.userRepo, query.Since)
+}
+
+func (h *UsersHandler) events(c *gin.Context) {
+	if aerr := gateway.CheckDraining(); aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	var query api.UserGatewayQuery
+	err := c.ShouldBindQuery(&query)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	var header api.UserEventsHeader
+	err = c.ShouldBindHeader(&header)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	since := query.Since
+	if header.LastEventID != "" {
+		since = header.LastEventID
+	}
+
+	user, aerr := h.userRepo.GetById(middleware.GetUserIdFromContext(c))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	gateway.ServeUserEvents(c.Writer, c.Request, user, since)
 }
 
 func (h *UsersHandler) getDevices(c *gin.Context) {
+	var listQuery api.DeviceListQuery
+	err := c.ShouldBindQuery(&listQuery)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
 	userId := middleware.GetUserIdFromContext(c)
-	user, aerr := h.userRepo.GetById(userId)
+	query := &repo.DeviceQuery{
+		UserID:     userId,
+		Search:     listQuery.Search,
+		Tags:       listQuery.Tags,
+		Sort:       strings.TrimPrefix(listQuery.Sort, "-"),
+		Descending: strings.HasPrefix(listQuery.Sort, "-"),
+		Cursor:     listQuery.Cursor,
+	}
+	if listQuery.Limit != "" {
+		limit, _ := strconv.Atoi(listQuery.Limit)
+		query.Limit = min(limit, MaxDeviceLimit)
+	}
+
+	// The state of the devices is only known by the gateways, the filters on it become a list of ids
+	if listQuery.Online != "" || listQuery.Status != "" {
+		deviceIds, aerr := h.deviceRepo.GetIdsByUserId(userId)
+		if aerr != nil {
+			c.Error(aerr)
+			return
+		}
+		status, _ := strconv.Atoi(listQuery.Status)
+		query.Only = make([]string, 0)
+		for deviceId, state := range gateway.GetDeviceStates(deviceIds...) {
+			if listQuery.Online != "" && strconv.FormatBool(state.Online) != listQuery.Online {
+				continue
+			}
+			if listQuery.Status != "" && state.Status != status {
+				continue
+			}
+			query.Only = append(query.Only, deviceId)
+		}
+	}
+
+	page, aerr := h.deviceRepo.Find(query)
 	if aerr != nil {
 		c.Error(aerr)
 		return
@@ -61,29 +165,21 @@ func (h *UsersHandler) getDevices(c *gin.Context) {
 	devicesInfoList := api.DeviceInfoList{
 		OnlineDevices:  make([]api.DeviceInfo, 0),
 		OfflineDevices: make([]api.DeviceInfo, 0),
+		Total:          page.Total,
+		NextCursor:     page.NextCursor,
 	}
-	for _, device := range user.Devices {
-		gateway.ConnectedDevicesMu.Lock()
-		if conn, ok := gateway.ConnectedDevices[device.ID]; ok {
-			devicesInfoList.OnlineDevices = append(devicesInfoList.OnlineDevices, api.DeviceInfo{
-				ID:     device.ID,
-				Name:   device.Name,
-				Code:   device.Code,
-				Secret: device.Secret,
-				Status: conn.GetStatus(),
-				Online: true,
-			})
+	deviceIds := make([]string, 0, len(page.Devices))
+	for _, device := range page.Devices {
+		deviceIds = append(deviceIds, device.ID)
+	}
+	states := gateway.GetDeviceStates(deviceIds...)
+	for _, device := range page.Devices {
+		state := states[device.ID]
+		if state.Online {
+			devicesInfoList.OnlineDevices = append(devicesInfoList.OnlineDevices, toDeviceInfo(&device, state.Status, true))
 		} else {
-			devicesInfoList.OfflineDevices = append(devicesInfoList.OfflineDevices, api.DeviceInfo{
-				ID:     device.ID,
-				Name:   device.Name,
-				Code:   device.Code,
-				Secret: device.Secret,
-				Status: 0,
-				Online: false,
-			})
+			devicesInfoList.OfflineDevices = append(devicesInfoList.OfflineDevices, toDeviceInfo(&device, 0, false))
 		}
-		gateway.ConnectedDevicesMu.Unlock()
 	}
 
 	c.JSON(http.StatusOK, devicesInfoList)
@@ -103,22 +199,8 @@ func (h *UsersHandler) getDevice(c *gin.Context) {
 		return
 	}
 
-	status := 0
-	online := false
-	gateway.ConnectedDevicesMu.Lock()
-	defer gateway.ConnectedDevicesMu.Unlock()
-	if conn, ok := gateway.ConnectedDevices[device.ID]; ok {
-		status = conn.GetStatus()
-		online = true
-	}
-	c.JSON(http.StatusOK, api.DeviceInfo{
-		ID:     device.ID,
-		Name:   device.Name,
-		Code:   device.Code,
-		Secret: device.Secret,
-		Status: status,
-		Online: online,
-	})
+	state := gateway.GetDeviceState(device.ID)
+	c.JSON(http.StatusOK, toDeviceInfo(device, state.Status, state.Online))
 }
 
 func (h *UsersHandler) createDevice(c *gin.Context) {
@@ -135,26 +217,24 @@ func (h *UsersHandler) createDevice(c *gin.Context) {
 	deviceSecret := util.GenerateRandomString(DeviceSecretLength)
 
 	var device = entity.Device{
-		ID:     deviceUuid.String(),
-		Name:   deviceInfo.Name,
-		Code:   deviceCode,
-		Secret: deviceSecret,
-		UserID: ownerId,
+		ID:       deviceUuid.String(),
+		Name:     deviceInfo.Name,
+		Code:     &deviceCode,
+		Secret:   deviceSecret,
+		UserID:   ownerId,
+		WolRelay: deviceInfo.WolRelay,
+		Channels: deviceInfo.Channels,
 	}
+	setDeviceMetadata(&device, deviceInfo)
 
-	aerr := h.deviceRepo.Create(&device)
+	aerr := h.deviceRepo.Create(&device, checkDeviceLimit)
 	if aerr != nil {
 		c.Error(aerr)
 		return
 	}
-	pubsub.Publish(ownerId, device)
+	gateway.NotifyDeviceCreated(&device)
 
-	c.JSON(http.StatusOK, api.DeviceInfo{
-		ID:     device.ID,
-		Name:   device.Name,
-		Code:   device.Code,
-		Secret: device.Secret,
-	})
+	c.JSON(http.StatusOK, toDeviceInfo(&device, 0, false))
 }
 
 func (h *UsersHandler) updateDevice(c *gin.Context) {
@@ -179,18 +259,78 @@ func (h *UsersHandler) updateDevice(c *gin.Context) {
 	}
 
 	device.Name = deviceInfo.Name
+	device.WolRelay = deviceInfo.WolRelay
+	if device.ParentID == nil {
+		device.Channels = deviceInfo.Channels
+	}
+	setDeviceMetadata(device, deviceInfo)
+	aerr = h.deviceRepo.Update(device)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	gateway.NotifyDeviceUpdated(device)
+
+	c.JSON(http.StatusOK, toDeviceInfo(device, 0, false))
+}
+
+func (h *UsersHandler) patchDevice(c *gin.Context) {
+	deviceId := c.Param(IdPathParam)
+	device, aerr := h.deviceRepo.GetById(deviceId)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	ownerId := middleware.GetUserIdFromContext(c)
+	if ownerId != device.UserID {
+		c.Error(errors.New(UserDoesNotOwnDevice))
+		return
+	}
+
+	var patch *api.DevicePatchInfo
+	err := c.ShouldBind(&patch)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	if patch.Name != nil {
+		device.Name = *patch.Name
+	}
+	if patch.WolRelay != nil {
+		device.WolRelay = *patch.WolRelay
+	}
+	if patch.Channels != nil && device.ParentID == nil {
+		device.Channels = *patch.Channels
+	}
+	if patch.MacAddress != nil {
+		device.MacAddress = *patch.MacAddress
+	}
+	if patch.Host != nil {
+		device.Host = *patch.Host
+	}
+	if patch.Notes != nil {
+		device.Notes = *patch.Notes
+	}
+	if patch.Location != nil {
+		device.Location = *patch.Location
+	}
+	if patch.Icon != nil {
+		device.Icon = *patch.Icon
+	}
+	if patch.Tags != nil {
+		device.SetTags(*patch.Tags)
+	}
 	aerr = h.deviceRepo.Update(device)
 	if aerr != nil {
 		c.Error(aerr)
 		return
 	}
+	gateway.NotifyDeviceUpdated(device)
 
-	c.JSON(http.StatusOK, api.DeviceInfo{
-		ID:     device.ID,
-		Name:   device.Name,
-		Code:   device.Code,
-		Secret: device.Secret,
-	})
+	state := gateway.GetDeviceState(device.ID)
+	c.JSON(http.StatusOK, toDeviceInfo(device, state.Status, state.Online))
 }
 
 func (h *UsersHandler) deleteDevice(c *gin.Context) {
@@ -207,11 +347,257 @@ func (h *UsersHandler) deleteDevice(c *gin.Context) {
 		return
 	}
 
+	channels, aerr := h.deviceRepo.GetChannels(device.ID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
 	aerr = h.deviceRepo.Delete(device)
 	if aerr != nil {
 		c.Error(aerr)
 		return
 	}
+	for i := range channels {
+		gateway.RevokeDevice(&channels[i], apigateway.DeviceDeletedReason)
+		gateway.NotifyDeviceDeleted(&channels[i])
+	}
+	gateway.RevokeDevice(device, apigateway.DeviceDeletedReason)
+	gateway.NotifyDeviceDeleted(device)
 
 	c.Status(http.StatusNoContent)
 }
+
+func (h *UsersHandler) createChannel(c *gin.Context) {
+	board, aerr := h.deviceRepo.GetById(c.Param(IdPathParam))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	ownerId := middleware.GetUserIdFromContext(c)
+	if ownerId != board.UserID {
+		c.Error(errors.New(UserDoesNotOwnDevice))
+		return
+	}
+
+	if board.ParentID != nil || board.Channels == 0 {
+		c.Error(errors.New(DeviceIsNotRelayBoard))
+		return
+	}
+
+	var channelInfo *api.ChannelCreateInfo
+	err := c.ShouldBind(&channelInfo)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	var device = entity.Device{
+		ID:       uuid.New().String(),
+		Name:     channelInfo.Name,
+		UserID:   ownerId,
+		ParentID: &board.ID,
+		Channel:  channelInfo.Channel,
+	}
+
+	aerr = h.deviceRepo.CreateChannel(&device)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	gateway.NotifyDeviceCreated(&device)
+	gateway.AttachChannel(&device)
+
+	c.JSON(http.StatusOK, toDeviceInfo(&device, 0, false))
+}
+
+func (h *UsersHandler) rotateSecret(c *gin.Context) {
+	device, aerr := h.deviceRepo.GetById(c.Param(IdPathParam))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	ownerId := middleware.GetUserIdFromContext(c)
+	if ownerId != device.UserID {
+		c.Error(errors.New(UserDoesNotOwnDevice))
+		return
+	}
+
+	if device.ParentID != nil {
+		c.Error(errors.New(ChannelHasNoCredentials))
+		return
+	}
+
+	revoked := *device
+	device.Secret = util.GenerateRandomString(DeviceSecretLength)
+	aerr = h.deviceRepo.Update(device)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	gateway.RevokeDevice(&revoked, apigateway.SecretRotatedReason)
+
+	c.JSON(http.StatusOK, toDeviceInfo(device, 0, false))
+}
+
+func (h *UsersHandler) getTrash(c *gin.Context) {
+	devices, aerr := h.deviceRepo.GetTrashByUserId(middleware.GetUserIdFromContext(c))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	trash := make([]api.TrashedDeviceInfo, 0, len(devices))
+	for i := range devices {
+		trash = append(trash, toTrashedDeviceInfo(&devices[i]))
+	}
+	c.JSON(http.StatusOK, trash)
+}
+
+// restoreDevice takes a device out of the trash with a new secret, the previous one may have leaked since it was
+// deleted
+func (h *UsersHandler) restoreDevice(c *gin.Context) {
+	device, aerr := h.deviceRepo.GetTrashedById(c.Param(IdPathParam))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	ownerId := middleware.GetUserIdFromContext(c)
+	if ownerId != device.UserID {
+		c.Error(errors.New(UserDoesNotOwnDevice))
+		return
+	}
+
+	if device.ParentID == nil {
+		device.Secret = util.GenerateRandomString(DeviceSecretLength)
+	}
+	aerr = h.deviceRepo.Restore(device, checkDeviceLimit)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	channels, aerr := h.deviceRepo.GetChannels(device.ID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	gateway.NotifyDeviceCreated(device)
+	for i := range channels {
+		gateway.NotifyDeviceCreated(&channels[i])
+	}
+	if device.ParentID != nil {
+		gateway.AttachChannel(device)
+	}
+
+	c.JSON(http.StatusOK, toDeviceInfo(device, 0, false))
+}
+
+func (h *UsersHandler) purgeDevice(c *gin.Context) {
+	device, aerr := h.deviceRepo.GetTrashedById(c.Param(IdPathParam))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	ownerId := middleware.GetUserIdFromContext(c)
+	if ownerId != device.UserID {
+		c.Error(errors.New(UserDoesNotOwnDevice))
+		return
+	}
+
+	aerr = h.deviceRepo.Purge(device)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *UsersHandler) deleteAccount(c *gin.Context) {
+	var data *api.AccountDeleteInfo
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	user, aerr := h.userRepo.GetById(middleware.GetUserIdFromContext(c))
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(data.Password)) != nil {
+		c.Error(errors.New(IncorrectPassword))
+		return
+	}
+
+	aerr = h.userRepo.Delete(user)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	for i := range user.Devices {
+		gateway.RevokeDevice(&user.Devices[i], apigateway.AccountDeletedReason)
+	}
+	gateway.NotifyAccountDeleted(user.ID)
+
+	c.Status(http.StatusNoContent)
+}
+
+func toDeviceInfo(device *entity.Device, status int, online bool) api.DeviceInfo {
+	deviceInfo := api.DeviceInfo{
+		ID:         device.ID,
+		Name:       device.Name,
+		Secret:     device.Secret,
+		Status:     status,
+		Online:     online,
+		WolRelay:   device.WolRelay,
+		Channels:   device.Channels,
+		MacAddress: device.MacAddress,
+		Host:       device.Host,
+		Notes:      device.Notes,
+		Location:   device.Location,
+		Icon:       device.Icon,
+		Tags:       device.TagNames(),
+	}
+	if device.Code != nil {
+		deviceInfo.Code = *device.Code
+	}
+	if device.ParentID != nil {
+		channel := device.Channel
+		deviceInfo.ParentID = *device.ParentID
+		deviceInfo.Channel = &channel
+	}
+	return deviceInfo
+}
+
+func setDeviceMetadata(device *entity.Device, deviceInfo *api.DeviceCreateInfo) {
+	device.MacAddress = deviceInfo.MacAddress
+	device.Host = deviceInfo.Host
+	device.Notes = deviceInfo.Notes
+	device.Location = deviceInfo.Location
+	device.Icon = deviceInfo.Icon
+	device.SetTags(deviceInfo.Tags)
+}
+
+func toTrashedDeviceInfo(device *entity.Device) api.TrashedDeviceInfo {
+	deviceInfo := api.TrashedDeviceInfo{
+		ID:        device.ID,
+		Name:      device.Name,
+		WolRelay:  device.WolRelay,
+		Channels:  device.Channels,
+		DeletedAt: device.DeletedAt.Time,
+	}
+	if device.ParentID != nil {
+		channel := device.Channel
+		deviceInfo.ParentID = *device.ParentID
+		deviceInfo.Channel = &channel
+	}
+	return deviceInfo
+}
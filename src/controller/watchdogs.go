@@ -0,0 +1,170 @@
+package controller
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-errors/errors"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/api"
+	"github.com/pc-power-api/src/controller/middleware"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/infra/repo"
+	"net/http"
+	"time"
+)
+
+type WatchdogsHandler struct {
+	deviceRepo   *repo.DeviceRepository
+	watchdogRepo *repo.WatchdogRepository
+}
+
+func NewWatchdogsHandler(e *gin.Engine, jwtMiddleware *jwt.GinJWTMiddleware, deviceRepo *repo.DeviceRepository, watchdogRepo *repo.WatchdogRepository) {
+	handler := &WatchdogsHandler{
+		deviceRepo:   deviceRepo,
+		watchdogRepo: watchdogRepo,
+	}
+
+	e.POST("/devices/heartbeat", handler.heartbeat)
+
+	group := e.Group("/user/devices/:"+IdPathParam+"/watchdog", jwtMiddleware.MiddlewareFunc())
+	{
+		group.GET("", handler.getWatchdog)
+		group.PUT("", handler.saveWatchdog)
+		group.DELETE("", handler.deleteWatchdog)
+	}
+}
+
+func (h *WatchdogsHandler) heartbeat(c *gin.Context) {
+	var data *api.DeviceIdentify
+	err := c.ShouldBindQuery(&data)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	device, aerr := h.deviceRepo.GetByIdAndSecret(data)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	aerr = h.watchdogRepo.UpdateHeartbeat(device.ID, time.Now())
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *WatchdogsHandler) getWatchdog(c *gin.Context) {
+	device, aerr := h.getOwnedDevice(c)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	watchdog, aerr := h.watchdogRepo.GetByDeviceId(device.ID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, toWatchdogInfo(watchdog))
+}
+
+func (h *WatchdogsHandler) saveWatchdog(c *gin.Context) {
+	device, aerr := h.getOwnedDevice(c)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	var watchdogInfo *api.WatchdogInfo
+	err := c.ShouldBind(&watchdogInfo)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	watchdog, aerr := h.watchdogRepo.GetByDeviceId(device.ID)
+	if aerr != nil {
+		if !errors.Is(aerr, repo.WatchdogNotFoundError) {
+			c.Error(aerr)
+			return
+		}
+		watchdog = &entity.Watchdog{
+			ID:       uuid.New().String(),
+			DeviceID: device.ID,
+		}
+	}
+	watchdog.Enabled = watchdogInfo.Enabled
+	watchdog.HeartbeatTimeout = watchdogInfo.HeartbeatTimeout
+	watchdog.Steps = make([]entity.WatchdogStep, 0, len(watchdogInfo.Steps))
+	for i, step := range watchdogInfo.Steps {
+		watchdog.Steps = append(watchdog.Steps, entity.WatchdogStep{
+			WatchdogID: watchdog.ID,
+			Position:   i,
+			Action:     step.Action,
+			Delay:      step.Delay,
+		})
+	}
+
+	aerr = h.watchdogRepo.Save(watchdog)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, toWatchdogInfo(watchdog))
+}
+
+func (h *WatchdogsHandler) deleteWatchdog(c *gin.Context) {
+	device, aerr := h.getOwnedDevice(c)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	watchdog, aerr := h.watchdogRepo.GetByDeviceId(device.ID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	aerr = h.watchdogRepo.Delete(watchdog)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *WatchdogsHandler) getOwnedDevice(c *gin.Context) (*entity.Device, *errors.Error) {
+	device, aerr := h.deviceRepo.GetById(c.Param(IdPathParam))
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	if middleware.GetUserIdFromContext(c) != device.UserID {
+		return nil, errors.New(UserDoesNotOwnDevice)
+	}
+	return device, nil
+}
+
+func toWatchdogInfo(watchdog *entity.Watchdog) api.WatchdogInfo {
+	steps := make([]api.WatchdogStepInfo, 0, len(watchdog.Steps))
+	for _, step := range watchdog.Steps {
+		steps = append(steps, api.WatchdogStepInfo{
+			Action: step.Action,
+			Delay:  step.Delay,
+		})
+	}
+	return api.WatchdogInfo{
+		DeviceID:         watchdog.DeviceID,
+		Enabled:          watchdog.Enabled,
+		HeartbeatTimeout: watchdog.HeartbeatTimeout,
+		Steps:            steps,
+		LastHeartbeat:    watchdog.LastHeartbeat,
+	}
+}
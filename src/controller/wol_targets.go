@@ -0,0 +1,132 @@
+package controller
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-errors/errors"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/api"
+	"github.com/pc-power-api/src/controller/middleware"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/infra/repo"
+	"net/http"
+	"strings"
+)
+
+const TargetIdPathParam = "target_id"
+
+var DeviceIsNotWolRelay = exceptions.NewUnsupportedOperation("the device is not a wake-on-lan relay")
+
+type WolTargetsHandler struct {
+	deviceRepo    *repo.DeviceRepository
+	wolTargetRepo *repo.WolTargetRepository
+}
+
+func NewWolTargetsHandler(e *gin.Engine, jwtMiddleware *jwt.GinJWTMiddleware, deviceRepo *repo.DeviceRepository, wolTargetRepo *repo.WolTargetRepository) {
+	handler := &WolTargetsHandler{
+		deviceRepo:    deviceRepo,
+		wolTargetRepo: wolTargetRepo,
+	}
+
+	group := e.Group("/user/devices/:"+IdPathParam+"/wol-targets", jwtMiddleware.MiddlewareFunc())
+	{
+		group.POST("/", handler.createTarget)
+		group.GET("/", handler.getTargets)
+		group.DELETE("/:"+TargetIdPathParam, handler.deleteTarget)
+	}
+}
+
+func (h *WolTargetsHandler) createTarget(c *gin.Context) {
+	device, aerr := h.getOwnedRelay(c)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	var targetInfo *api.WolTargetInfo
+	err := c.ShouldBind(&targetInfo)
+	if err != nil {
+		c.Error(errors.New(err))
+		return
+	}
+
+	target := entity.WolTarget{
+		ID:         uuid.New().String(),
+		DeviceID:   device.ID,
+		Name:       targetInfo.Name,
+		MacAddress: strings.ToLower(targetInfo.MacAddress),
+	}
+	aerr = h.wolTargetRepo.Create(&target)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, toWolTargetInfo(&target))
+}
+
+func (h *WolTargetsHandler) getTargets(c *gin.Context) {
+	device, aerr := h.getOwnedRelay(c)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	targets, aerr := h.wolTargetRepo.GetByDeviceId(device.ID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	targetsInfo := make([]api.WolTargetInfo, 0, len(targets))
+	for i := range targets {
+		targetsInfo = append(targetsInfo, toWolTargetInfo(&targets[i]))
+	}
+	c.JSON(http.StatusOK, targetsInfo)
+}
+
+func (h *WolTargetsHandler) deleteTarget(c *gin.Context) {
+	device, aerr := h.getOwnedRelay(c)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	target, aerr := h.wolTargetRepo.GetByIdAndDeviceId(c.Param(TargetIdPathParam), device.ID)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	aerr = h.wolTargetRepo.Delete(target)
+	if aerr != nil {
+		c.Error(aerr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *WolTargetsHandler) getOwnedRelay(c *gin.Context) (*entity.Device, *errors.Error) {
+	device, aerr := h.deviceRepo.GetById(c.Param(IdPathParam))
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	if middleware.GetUserIdFromContext(c) != device.UserID {
+		return nil, errors.New(UserDoesNotOwnDevice)
+	}
+	if !device.WolRelay {
+		return nil, errors.New(DeviceIsNotWolRelay)
+	}
+	return device, nil
+}
+
+func toWolTargetInfo(target *entity.WolTarget) api.WolTargetInfo {
+	return api.WolTargetInfo{
+		ID:         target.ID,
+		Name:       target.Name,
+		MacAddress: target.MacAddress,
+	}
+}
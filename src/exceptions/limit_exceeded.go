@@ -0,0 +1,20 @@
+package exceptions
+
+import "time"
+
+// LimitExceeded is returned when a quota is reached, RetryAfter is set when the limit is a rate that frees up over time
+type LimitExceeded struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func NewLimitExceeded(message string, retryAfter time.Duration) *LimitExceeded {
+	return &LimitExceeded{
+		Message:    message,
+		RetryAfter: retryAfter,
+	}
+}
+
+func (e *LimitExceeded) Error() string {
+	return e.Message
+}
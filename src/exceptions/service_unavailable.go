@@ -0,0 +1,20 @@
+package exceptions
+
+import "time"
+
+// ServiceUnavailable is returned while the API is shutting down, RetryAfter is when a restarted instance should be up
+type ServiceUnavailable struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func NewServiceUnavailable(message string, retryAfter time.Duration) *ServiceUnavailable {
+	return &ServiceUnavailable{
+		Message:    message,
+		RetryAfter: retryAfter,
+	}
+}
+
+func (e *ServiceUnavailable) Error() string {
+	return e.Message
+}
@@ -0,0 +1,15 @@
+package exceptions
+
+type UnsupportedOperation struct {
+	Message string
+}
+
+func NewUnsupportedOperation(message string) *UnsupportedOperation {
+	return &UnsupportedOperation{
+		Message: message,
+	}
+}
+
+func (e *UnsupportedOperation) Error() string {
+	return e.Message
+}
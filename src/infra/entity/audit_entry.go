@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+const WatchdogActor = "watchdog"
+
+type AuditEntry struct {
+	ID        string `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    string `gorm:"size:36;index"`
+	DeviceID  string `gorm:"size:36"`
+	Actor     string
+	Action    string
+	Details   string
+}
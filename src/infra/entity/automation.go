@@ -0,0 +1,35 @@
+package entity
+
+import "time"
+
+const AutomationActor = "automation"
+
+const DeviceOfflineTrigger = "device_offline"
+const StatusChangedTrigger = "status_changed"
+const DeviceOnTrigger = "device_on"
+const TimeWindowTrigger = "time_window"
+
+const CommandAction = "command"
+const WebhookAction = "webhook"
+const NotifyAction = "notify"
+
+type Automation struct {
+	ID              string `gorm:"primarykey"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	UserID          string `gorm:"size:36;index"`
+	Name            string
+	Enabled         bool
+	TriggerType     string
+	TriggerDeviceID string `gorm:"size:36;index"`
+	TriggerStatus   *int
+	WindowStart     string
+	WindowEnd       string
+	Debounce        int
+	ActionType      string
+	ActionDeviceID  string `gorm:"size:36"`
+	ActionCommand   string
+	WebhookURL      string
+	Message         string
+	LastFiredAt     *time.Time
+}
@@ -0,0 +1,31 @@
+package entity
+
+import "time"
+
+const CommandClusterMessage = "command"
+const ResultClusterMessage = "result"
+const EventClusterMessage = "event"
+
+// ClusterInstance is an API instance taking part in the cluster, it is considered gone once LastSeen gets too old
+type ClusterInstance struct {
+	ID       string    `gorm:"primarykey;size:36"`
+	LastSeen time.Time `gorm:"index"`
+}
+
+// DevicePresence records the instance holding the socket of a connected device
+type DevicePresence struct {
+	DeviceID   string `gorm:"primarykey;size:36"`
+	InstanceID string `gorm:"size:36;index"`
+	Status     int
+	UpdatedAt  time.Time
+}
+
+// ClusterMessage is read by every other instance when Target is empty
+type ClusterMessage struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	Source    string    `gorm:"size:36"`
+	Target    string    `gorm:"size:36;index"`
+	Kind      string
+	Payload   string `gorm:"type:text"`
+}
@@ -6,12 +6,42 @@ import (
 )
 
 type Device struct {
-	ID        string `gorm:"primarykey"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	DeletedAt gorm.DeletedAt `gorm:"index"`
-	Name      string
-	Code      string `gorm:"unique"`
-	Secret    string
-	UserID    string `gorm:"size:36"`
+	ID         string `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  gorm.DeletedAt `gorm:"index"`
+	Name       string
+	Code       *string `gorm:"unique"`
+	Secret     string
+	UserID     string `gorm:"size:36"`
+	WolRelay   bool
+	Channels   int
+	ParentID   *string `gorm:"size:36;index;uniqueIndex:idx_devices_parent_channel"`
+	Channel    int     `gorm:"uniqueIndex:idx_devices_parent_channel"`
+	MacAddress string
+	Host       string
+	Notes      string `gorm:"type:text"`
+	Location   string
+	Icon       string
+	Tags       []DeviceTag `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+type DeviceTag struct {
+	DeviceID string `gorm:"primarykey;size:36"`
+	Name     string `gorm:"primarykey;size:32;index"`
+}
+
+func (d *Device) TagNames() []string {
+	names := make([]string, 0, len(d.Tags))
+	for _, tag := range d.Tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+func (d *Device) SetTags(names []string) {
+	d.Tags = make([]DeviceTag, 0, len(names))
+	for _, name := range names {
+		d.Tags = append(d.Tags, DeviceTag{DeviceID: d.ID, Name: name})
+	}
 }
@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+// DeviceTransfer is an offer of a device to another user, a device has at most one pending transfer
+type DeviceTransfer struct {
+	ID                 string `gorm:"primarykey"`
+	CreatedAt          time.Time
+	ExpiresAt          time.Time
+	DeviceID           string `gorm:"size:36;uniqueIndex"`
+	FromUserID         string `gorm:"size:36;index"`
+	ToUserID           string `gorm:"size:36;index"`
+	ClearConfiguration bool
+}
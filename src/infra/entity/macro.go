@@ -0,0 +1,52 @@
+package entity
+
+import "time"
+
+const MacroActor = "macro"
+
+const CommandStep = "command"
+const WaitStateStep = "wait_state"
+const DelayStep = "delay"
+
+type Macro struct {
+	ID        string `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    string `gorm:"size:36;index"`
+	Name      string
+	Steps     []MacroStep `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+type MacroStep struct {
+	ID       uint   `gorm:"primarykey"`
+	MacroID  string `gorm:"size:36;index"`
+	Position int
+	Type     string
+	DeviceID string `gorm:"size:36"`
+	Command  string
+	Status   int
+	Timeout  int
+	Duration int
+}
+
+// MacroRun records the progress of a macro so that any instance can report it
+type MacroRun struct {
+	ID         string `gorm:"primarykey"`
+	UserID     string `gorm:"size:36;index"`
+	MacroID    string `gorm:"size:36"`
+	Status     string
+	StartedAt  time.Time
+	FinishedAt *time.Time     `gorm:"index"`
+	Steps      []MacroRunStep `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+type MacroRunStep struct {
+	MacroRunID string `gorm:"primarykey;size:36"`
+	Position   int    `gorm:"primarykey;autoIncrement:false"`
+	Type       string
+	DeviceID   string `gorm:"size:36"`
+	Status     string
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+	Error      string `gorm:"type:text"`
+}
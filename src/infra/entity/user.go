@@ -5,6 +5,10 @@ import (
 	"time"
 )
 
+const UserRole = "user"
+const AdminRole = "admin"
+const AdminActor = "admin"
+
 type User struct {
 	ID        string `gorm:"primarykey"`
 	CreatedAt time.Time
@@ -12,6 +16,8 @@ type User struct {
 	DeletedAt gorm.DeletedAt `gorm:"index"`
 	Username  string         `gorm:"unique"`
 	Password  string
+	Role      string `gorm:"size:16;default:user"`
+	Disabled  bool
 	Devices   []Device
 }
 
@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+type Watchdog struct {
+	ID               string `gorm:"primarykey"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	DeviceID         string `gorm:"size:36;uniqueIndex"`
+	Enabled          bool
+	HeartbeatTimeout int
+	LastHeartbeat    *time.Time
+	Steps            []WatchdogStep `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+type WatchdogStep struct {
+	ID         uint   `gorm:"primarykey"`
+	WatchdogID string `gorm:"size:36;index"`
+	Position   int
+	Action     string
+	Delay      int
+}
@@ -0,0 +1,12 @@
+package entity
+
+import "time"
+
+type WolTarget struct {
+	ID         string `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeviceID   string `gorm:"size:36;index"`
+	Name       string
+	MacAddress string
+}
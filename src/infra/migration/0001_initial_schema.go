@@ -0,0 +1,155 @@
+package migration
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// The models are copied from the entities as they were when the migrations were introduced, the entities keep
+// changing while this migration must always create the same schema. AutoMigrate leaves the tables already created
+// by the previous releases untouched, which lets the existing databases adopt the migrations.
+var initialSchema = Migration{
+	Version: 1,
+	Name:    "initial schema",
+	Up: func(tx *gorm.DB) error {
+		type DeviceTag struct {
+			DeviceID string `gorm:"primarykey;size:36"`
+			Name     string `gorm:"primarykey;size:32;index"`
+		}
+		type Device struct {
+			ID         string `gorm:"primarykey"`
+			CreatedAt  time.Time
+			UpdatedAt  time.Time
+			DeletedAt  gorm.DeletedAt `gorm:"index"`
+			Name       string
+			Code       string `gorm:"unique"`
+			Secret     string
+			UserID     string `gorm:"size:36"`
+			WolRelay   bool
+			Channels   int
+			ParentID   *string `gorm:"size:36;index"`
+			Channel    int
+			MacAddress string
+			Host       string
+			Notes      string `gorm:"type:text"`
+			Location   string
+			Icon       string
+			Tags       []DeviceTag `gorm:"constraint:OnDelete:CASCADE"`
+		}
+		type User struct {
+			ID        string `gorm:"primarykey"`
+			CreatedAt time.Time
+			UpdatedAt time.Time
+			DeletedAt gorm.DeletedAt `gorm:"index"`
+			Username  string         `gorm:"unique"`
+			Password  string
+			Role      string `gorm:"size:16;default:user"`
+			Disabled  bool
+			Devices   []Device
+		}
+		type WatchdogStep struct {
+			ID         uint   `gorm:"primarykey"`
+			WatchdogID string `gorm:"size:36;index"`
+			Position   int
+			Action     string
+			Delay      int
+		}
+		type Watchdog struct {
+			ID               string `gorm:"primarykey"`
+			CreatedAt        time.Time
+			UpdatedAt        time.Time
+			DeviceID         string `gorm:"size:36;uniqueIndex"`
+			Enabled          bool
+			HeartbeatTimeout int
+			LastHeartbeat    *time.Time
+			Steps            []WatchdogStep `gorm:"constraint:OnDelete:CASCADE"`
+		}
+		type AuditEntry struct {
+			ID        string `gorm:"primarykey"`
+			CreatedAt time.Time
+			UserID    string `gorm:"size:36;index"`
+			DeviceID  string `gorm:"size:36"`
+			Actor     string
+			Action    string
+			Details   string
+		}
+		type Automation struct {
+			ID              string `gorm:"primarykey"`
+			CreatedAt       time.Time
+			UpdatedAt       time.Time
+			UserID          string `gorm:"size:36;index"`
+			Name            string
+			Enabled         bool
+			TriggerType     string
+			TriggerDeviceID string `gorm:"size:36;index"`
+			TriggerStatus   *int
+			WindowStart     string
+			WindowEnd       string
+			Debounce        int
+			ActionType      string
+			ActionDeviceID  string `gorm:"size:36"`
+			ActionCommand   string
+			WebhookURL      string
+			Message         string
+			LastFiredAt     *time.Time
+		}
+		type MacroStep struct {
+			ID       uint   `gorm:"primarykey"`
+			MacroID  string `gorm:"size:36;index"`
+			Position int
+			Type     string
+			DeviceID string `gorm:"size:36"`
+			Command  string
+			Status   int
+			Timeout  int
+			Duration int
+		}
+		type Macro struct {
+			ID        string `gorm:"primarykey"`
+			CreatedAt time.Time
+			UpdatedAt time.Time
+			UserID    string `gorm:"size:36;index"`
+			Name      string
+			Steps     []MacroStep `gorm:"constraint:OnDelete:CASCADE"`
+		}
+		type WolTarget struct {
+			ID         string `gorm:"primarykey"`
+			CreatedAt  time.Time
+			UpdatedAt  time.Time
+			DeviceID   string `gorm:"size:36;index"`
+			Name       string
+			MacAddress string
+		}
+		type DeviceTransfer struct {
+			ID                 string `gorm:"primarykey"`
+			CreatedAt          time.Time
+			ExpiresAt          time.Time
+			DeviceID           string `gorm:"size:36;uniqueIndex"`
+			FromUserID         string `gorm:"size:36;index"`
+			ToUserID           string `gorm:"size:36;index"`
+			ClearConfiguration bool
+		}
+		type ClusterInstance struct {
+			ID       string    `gorm:"primarykey;size:36"`
+			LastSeen time.Time `gorm:"index"`
+		}
+		type DevicePresence struct {
+			DeviceID   string `gorm:"primarykey;size:36"`
+			InstanceID string `gorm:"size:36;index"`
+			Status     int
+			UpdatedAt  time.Time
+		}
+		type ClusterMessage struct {
+			ID        uint      `gorm:"primarykey"`
+			CreatedAt time.Time `gorm:"index"`
+			Source    string    `gorm:"size:36"`
+			Target    string    `gorm:"size:36;index"`
+			Kind      string
+			Payload   string `gorm:"type:text"`
+		}
+		return tx.AutoMigrate(&User{}, &Device{}, &DeviceTag{}, &Watchdog{}, &WatchdogStep{}, &AuditEntry{}, &Automation{}, &Macro{}, &MacroStep{}, &WolTarget{}, &DeviceTransfer{}, &ClusterInstance{}, &DevicePresence{}, &ClusterMessage{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable("cluster_messages", "device_presences", "cluster_instances", "device_transfers", "wol_targets", "macro_steps", "macros", "automations", "audit_entries", "watchdog_steps", "watchdogs", "device_tags", "devices", "users")
+	},
+}
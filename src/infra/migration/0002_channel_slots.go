@@ -0,0 +1,21 @@
+package migration
+
+import (
+	"gorm.io/gorm"
+)
+
+// channelSlots makes a channel of a relay board assigned to one device at most, the channels in the trash included
+var channelSlots = Migration{
+	Version: 2,
+	Name:    "channel slots",
+	Up: func(tx *gorm.DB) error {
+		type Device struct {
+			ParentID *string `gorm:"size:36;uniqueIndex:idx_devices_parent_channel"`
+			Channel  int     `gorm:"uniqueIndex:idx_devices_parent_channel"`
+		}
+		return tx.Migrator().CreateIndex(&Device{}, "idx_devices_parent_channel")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropIndex("devices", "idx_devices_parent_channel")
+	},
+}
@@ -0,0 +1,37 @@
+package migration
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// macroRuns keeps the progress of the macro runs in the database, every instance reports the runs started by another
+var macroRuns = Migration{
+	Version: 3,
+	Name:    "macro runs",
+	Up: func(tx *gorm.DB) error {
+		type MacroRunStep struct {
+			MacroRunID string `gorm:"primarykey;size:36"`
+			Position   int    `gorm:"primarykey;autoIncrement:false"`
+			Type       string
+			DeviceID   string `gorm:"size:36"`
+			Status     string
+			StartedAt  *time.Time
+			FinishedAt *time.Time
+			Error      string `gorm:"type:text"`
+		}
+		type MacroRun struct {
+			ID         string `gorm:"primarykey"`
+			UserID     string `gorm:"size:36;index"`
+			MacroID    string `gorm:"size:36"`
+			Status     string
+			StartedAt  time.Time
+			FinishedAt *time.Time     `gorm:"index"`
+			Steps      []MacroRunStep `gorm:"constraint:OnDelete:CASCADE"`
+		}
+		return tx.AutoMigrate(&MacroRun{}, &MacroRunStep{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable("macro_run_steps", "macro_runs")
+	},
+}
@@ -0,0 +1,9 @@
+package migration
+
+// migrations are applied in this order, a new migration is appended with the next version and never edited once
+// released
+var migrations = []Migration{
+	initialSchema,
+	channelSlots,
+	macroRuns,
+}
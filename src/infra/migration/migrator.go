@@ -0,0 +1,182 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-errors/errors"
+	"gorm.io/gorm"
+	"slices"
+	"time"
+)
+
+// Migration changes the schema from the previous version to its own one, Down reverts exactly what Up did
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	Version   uint `gorm:"primarykey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// Status is a known migration along with the time it was applied at, nil when pending
+type Status struct {
+	Version   uint
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB) *Migrator {
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}
+}
+
+// Status lists the known migrations, the versions applied by a newer release are reported by Check
+func (m *Migrator) Status() ([]Status, *errors.Error) {
+	applied, aerr := m.applied()
+	if aerr != nil {
+		return nil, aerr
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{
+			Version: migration.Version,
+			Name:    migration.Name,
+		}
+		if record, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &record.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Check fails when the database is not at the version of the latest known migration. It only reads the applied
+// versions so that it can be called by the readiness probe
+func (m *Migrator) Check(ctx context.Context) *errors.Error {
+	versions, aerr := m.versions(ctx)
+	if aerr != nil {
+		return aerr
+	}
+	for _, version := range versions {
+		if !slices.ContainsFunc(m.migrations, func(migration Migration) bool { return migration.Version == version }) {
+			return errors.Errorf("the database has been migrated to version %d which is unknown to this release", version)
+		}
+	}
+	pending := 0
+	for _, migration := range m.migrations {
+		if !slices.Contains(versions, migration.Version) {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return errors.Errorf("the database schema is %d migration(s) behind, run the migrate up command", pending)
+	}
+	return nil
+}
+
+// Up applies the pending migrations up to the given version, every one of them when the version is 0
+func (m *Migrator) Up(target uint) ([]Migration, *errors.Error) {
+	applied, aerr := m.applied()
+	if aerr != nil {
+		return nil, aerr
+	}
+	var done []Migration
+	for _, migration := range m.migrations {
+		if target != 0 && migration.Version > target {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return done, errors.Errorf("migration %s: %w", describe(migration), err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the given number of applied migrations, starting from the latest one
+func (m *Migrator) Down(steps int) ([]Migration, *errors.Error) {
+	applied, aerr := m.applied()
+	if aerr != nil {
+		return nil, aerr
+	}
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{Version: migration.Version}).Error
+		})
+		if err != nil {
+			return done, errors.Errorf("migration %s: %w", describe(migration), err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// versions returns the applied versions, none when the table recording them has not been created yet
+func (m *Migrator) versions(ctx context.Context) ([]uint, *errors.Error) {
+	db := m.db.WithContext(ctx)
+	var versions []uint
+	err := db.Model(&SchemaMigration{}).Pluck("version", &versions).Error
+	if err == nil {
+		return versions, nil
+	}
+	if ctx.Err() == nil && !db.Migrator().HasTable(&SchemaMigration{}) {
+		return nil, nil
+	}
+	return nil, errors.New(err)
+}
+
+// applied creates the table recording the migrations when missing
+func (m *Migrator) applied() (map[uint]SchemaMigration, *errors.Error) {
+	err := m.db.AutoMigrate(&SchemaMigration{})
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	var records []SchemaMigration
+	err = m.db.Find(&records).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	applied := make(map[uint]SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+func describe(migration Migration) string {
+	return fmt.Sprintf("%d %s", migration.Version, migration.Name)
+}
@@ -0,0 +1,125 @@
+package migration
+
+import (
+	"context"
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The databases given by these variables are emptied by the tests, the tests are skipped when they are not set
+const MysqlDSNVariable = "TEST_MYSQL_DSN"
+const PostgresDSNVariable = "TEST_POSTGRES_DSN"
+
+func forEachDatabase(t *testing.T, test func(t *testing.T, db *gorm.DB)) {
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, openTestDatabase(t, sqlite.Open(filepath.Join(t.TempDir(), "test.db"))))
+	})
+	t.Run("mysql", func(t *testing.T) {
+		dsn := os.Getenv(MysqlDSNVariable)
+		if dsn == "" {
+			t.Skipf("%s is not set", MysqlDSNVariable)
+		}
+		test(t, openTestDatabase(t, mysql.Open(dsn)))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv(PostgresDSNVariable)
+		if dsn == "" {
+			t.Skipf("%s is not set", PostgresDSNVariable)
+		}
+		test(t, openTestDatabase(t, postgres.Open(dsn)))
+	})
+}
+
+// openTestDatabase reverts the migrations left by a previous run and drops the table recording them
+func openTestDatabase(t *testing.T, dialector gorm.Dialector) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	if _, aerr := NewMigrator(db).Down(math.MaxInt); aerr != nil {
+		t.Fatal(aerr)
+	}
+	if err := db.Migrator().DropTable(&SchemaMigration{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMigrator(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		migrator := NewMigrator(db)
+		if aerr := migrator.Check(context.Background()); aerr == nil {
+			t.Fatal("expected an empty database to need the migrations")
+		}
+		if db.Migrator().HasTable(&SchemaMigration{}) {
+			t.Fatal("the check wrote to the database")
+		}
+
+		done, aerr := migrator.Up(0)
+		if aerr != nil {
+			t.Fatal(aerr)
+		}
+		if len(done) != len(migrations) {
+			t.Fatalf("expected every migration to be applied, got %d", len(done))
+		}
+		if aerr := migrator.Check(context.Background()); aerr != nil {
+			t.Fatal(aerr)
+		}
+		for _, table := range []string{"users", "devices", "device_tags", "automations", "macro_steps", "cluster_messages"} {
+			if !db.Migrator().HasTable(table) {
+				t.Fatalf("the table %s was not created", table)
+			}
+		}
+		statuses, aerr := migrator.Status()
+		if aerr != nil {
+			t.Fatal(aerr)
+		}
+		for _, status := range statuses {
+			if status.AppliedAt == nil {
+				t.Fatalf("the migration %d is reported as pending", status.Version)
+			}
+		}
+		if done, aerr := migrator.Up(0); aerr != nil || len(done) != 0 {
+			t.Fatalf("expected nothing left to apply, got %d, %v", len(done), aerr)
+		}
+
+		done, aerr = migrator.Down(1)
+		if aerr != nil {
+			t.Fatal(aerr)
+		}
+		if len(done) != 1 || done[0].Version != migrations[len(migrations)-1].Version {
+			t.Fatalf("expected the latest migration to be reverted, got %+v", done)
+		}
+		if aerr := migrator.Check(context.Background()); aerr == nil {
+			t.Fatal("expected the reverted migration to be pending")
+		}
+	})
+}
+
+func TestMigratorRefusesUnknownVersions(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		migrator := NewMigrator(db)
+		if _, aerr := migrator.Up(0); aerr != nil {
+			t.Fatal(aerr)
+		}
+		if err := db.Create(&SchemaMigration{Version: math.MaxInt32, Name: "from a newer release"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if aerr := migrator.Check(context.Background()); aerr == nil {
+			t.Fatal("expected the version unknown to this release to be refused")
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package repo
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/infra/entity"
+	"gorm.io/gorm"
+)
+
+const AuditPageSize = 100
+
+type AuditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) *AuditRepository {
+	return &AuditRepository{
+		db: db,
+	}
+}
+
+func (r *AuditRepository) Create(entry *entity.AuditEntry) *errors.Error {
+	err := r.db.Create(entry).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *AuditRepository) GetByUserId(userId string) ([]entity.AuditEntry, *errors.Error) {
+	var entries []entity.AuditEntry
+	err := r.db.Where("user_id = ?", userId).Order("created_at desc").Limit(AuditPageSize).Find(&entries).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return entries, nil
+}
+
+func (r *AuditRepository) GetByActor(actor string) ([]entity.AuditEntry, *errors.Error) {
+	var entries []entity.AuditEntry
+	err := r.db.Where("actor = ?", actor).Order("created_at desc").Limit(AuditPageSize).Find(&entries).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return entries, nil
+}
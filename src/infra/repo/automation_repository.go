@@ -0,0 +1,176 @@
+package repo
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
+	"gorm.io/gorm"
+	"time"
+)
+
+var AutomationNotFoundError = exceptions.NewObjectNotFound("automation not found")
+
+type AutomationRepository struct {
+	db *gorm.DB
+}
+
+func NewAutomationRepository(db *gorm.DB) *AutomationRepository {
+	return &AutomationRepository{
+		db: db,
+	}
+}
+
+// AutomationCountCheck fails when the user cannot have the automation given how many webhooks and schedules it has
+type AutomationCountCheck func(webhooks int64, schedules int64) *errors.Error
+
+// Create counts the webhooks and schedules of the owner for the check in the transaction inserting the automation
+func (r *AutomationRepository) Create(automation *entity.Automation, check AutomationCountCheck) *errors.Error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkAutomationCount(tx, automation.UserID, check); err != nil {
+			return err
+		}
+		return tx.Create(automation).Error
+	})
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+// Update counts the webhooks and schedules of the owner for the check in the transaction saving the automation
+func (r *AutomationRepository) Update(automation *entity.Automation, check AutomationCountCheck) *errors.Error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkAutomationCount(tx, automation.UserID, check); err != nil {
+			return err
+		}
+		return tx.Save(automation).Error
+	})
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *AutomationRepository) Delete(automation *entity.Automation) *errors.Error {
+	err := r.db.Delete(automation).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *AutomationRepository) GetById(id string) (*entity.Automation, *errors.Error) {
+	var automation entity.Automation
+	err := r.db.Where("id = ?", id).First(&automation).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New(AutomationNotFoundError)
+		}
+		return nil, errors.New(err)
+	}
+	return &automation, nil
+}
+
+func (r *AutomationRepository) GetByUserId(userId string) ([]entity.Automation, *errors.Error) {
+	var automations []entity.Automation
+	err := r.db.Where("user_id = ?", userId).Order("created_at").Find(&automations).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return automations, nil
+}
+
+// CountByUserId returns the number of automations of the user calling a webhook and the number triggered by a time
+// window
+func (r *AutomationRepository) CountByUserId(userId string) (int64, int64, *errors.Error) {
+	webhooks, schedules, err := countAutomations(r.db, userId)
+	if err != nil {
+		return 0, 0, errors.New(err)
+	}
+	return webhooks, schedules, nil
+}
+
+func countAutomations(db *gorm.DB, userId string) (int64, int64, error) {
+	var webhooks, schedules int64
+	err := db.Model(&entity.Automation{}).Where("user_id = ? AND action_type = ?", userId, entity.WebhookAction).Count(&webhooks).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	err = db.Model(&entity.Automation{}).Where("user_id = ? AND trigger_type = ?", userId, entity.TimeWindowTrigger).Count(&schedules).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	return webhooks, schedules, nil
+}
+
+// checkAutomationCount runs the check, if any, against the number of webhooks and schedules of the user
+func checkAutomationCount(tx *gorm.DB, userId string, check AutomationCountCheck) error {
+	if check == nil {
+		return nil
+	}
+	if err := lockUser(tx, userId); err != nil {
+		return err
+	}
+	webhooks, schedules, err := countAutomations(tx, userId)
+	if err != nil {
+		return err
+	}
+	if aerr := check(webhooks, schedules); aerr != nil {
+		return aerr.Err
+	}
+	return nil
+}
+
+func (r *AutomationRepository) GetEnabledByTriggerDevice(deviceId string) ([]entity.Automation, *errors.Error) {
+	var automations []entity.Automation
+	err := r.db.Where("enabled = ? AND trigger_device_id = ?", true, deviceId).
+		Where("user_id IN (?)", activeUserIds(r.db)).
+		Find(&automations).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return automations, nil
+}
+
+// GetEnabledTriggerDeviceIds returns the devices whose state changes trigger enabled automations
+func (r *AutomationRepository) GetEnabledTriggerDeviceIds() ([]string, *errors.Error) {
+	var deviceIds []string
+	err := r.db.Model(&entity.Automation{}).Distinct().Where("enabled = ? AND trigger_device_id <> ?", true, "").
+		Where("user_id IN (?)", activeUserIds(r.db)).
+		Pluck("trigger_device_id", &deviceIds).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return deviceIds, nil
+}
+
+func (r *AutomationRepository) GetEnabledByTrigger(trigger string) ([]entity.Automation, *errors.Error) {
+	var automations []entity.Automation
+	err := r.db.Where("enabled = ? AND trigger_type = ?", true, trigger).
+		Where("user_id IN (?)", activeUserIds(r.db)).
+		Find(&automations).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return automations, nil
+}
+
+func (r *AutomationRepository) UpdateLastFired(id string, firedAt time.Time) *errors.Error {
+	err := r.db.Model(&entity.Automation{}).Where("id = ?", id).Update("last_fired_at", firedAt).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+// ClaimWindow marks the automation as fired unless it already fired since the window opened, it returns false when
+// another instance claimed the window first
+func (r *AutomationRepository) ClaimWindow(id string, opened time.Time, firedAt time.Time) (bool, *errors.Error) {
+	result := r.db.Model(&entity.Automation{}).
+		Where("id = ? AND (last_fired_at IS NULL OR last_fired_at < ?)", id, opened).
+		Update("last_fired_at", firedAt)
+	if result.Error != nil {
+		return false, errors.New(result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
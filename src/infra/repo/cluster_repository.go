@@ -0,0 +1,125 @@
+package repo
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/infra/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type ClusterRepository struct {
+	db *gorm.DB
+}
+
+func NewClusterRepository(db *gorm.DB) *ClusterRepository {
+	return &ClusterRepository{
+		db: db,
+	}
+}
+
+func (r *ClusterRepository) Heartbeat(instanceId string, now time.Time) *errors.Error {
+	err := r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&entity.ClusterInstance{
+		ID:       instanceId,
+		LastSeen: now,
+	}).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+// DeleteStaleInstances removes the instances not seen since the given time along with the devices they were holding
+func (r *ClusterRepository) DeleteStaleInstances(before time.Time) *errors.Error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		stale := tx.Model(&entity.ClusterInstance{}).Select("id").Where("last_seen < ?", before)
+		err := tx.Where("instance_id IN (?)", stale).Delete(&entity.DevicePresence{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("last_seen < ?", before).Delete(&entity.ClusterInstance{}).Error
+	})
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *ClusterRepository) DeleteInstance(instanceId string) *errors.Error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("instance_id = ?", instanceId).Delete(&entity.DevicePresence{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&entity.ClusterInstance{ID: instanceId}).Error
+	})
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *ClusterRepository) SavePresence(presence *entity.DevicePresence) *errors.Error {
+	err := r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(presence).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+// DeletePresence only removes the presence when it still belongs to the instance, the device may have reconnected
+// to another one in the meantime
+func (r *ClusterRepository) DeletePresence(deviceId string, instanceId string) *errors.Error {
+	err := r.db.Where("device_id = ? AND instance_id = ?", deviceId, instanceId).Delete(&entity.DevicePresence{}).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+// GetPresences returns the presences of the given devices held by instances seen since the given time
+func (r *ClusterRepository) GetPresences(deviceIds []string, aliveSince time.Time) ([]entity.DevicePresence, *errors.Error) {
+	var presences []entity.DevicePresence
+	alive := r.db.Model(&entity.ClusterInstance{}).Select("id").Where("last_seen >= ?", aliveSince)
+	err := r.db.Where("device_id IN ? AND instance_id IN (?)", deviceIds, alive).Find(&presences).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return presences, nil
+}
+
+func (r *ClusterRepository) CreateMessage(message *entity.ClusterMessage) *errors.Error {
+	err := r.db.Create(message).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+// GetMessagesAfter returns the messages sent by the other instances to everyone or to the given one
+func (r *ClusterRepository) GetMessagesAfter(id uint, instanceId string) ([]entity.ClusterMessage, *errors.Error) {
+	var messages []entity.ClusterMessage
+	err := r.db.Where("id > ? AND source <> ? AND (target = '' OR target = ?)", id, instanceId, instanceId).
+		Order("id").Find(&messages).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return messages, nil
+}
+
+func (r *ClusterRepository) GetLastMessageId() (uint, *errors.Error) {
+	var id uint
+	err := r.db.Model(&entity.ClusterMessage{}).Select("COALESCE(MAX(id), 0)").Scan(&id).Error
+	if err != nil {
+		return 0, errors.New(err)
+	}
+	return id, nil
+}
+
+func (r *ClusterRepository) DeleteMessagesBefore(before time.Time) *errors.Error {
+	err := r.db.Where("created_at < ?", before).Delete(&entity.ClusterMessage{}).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
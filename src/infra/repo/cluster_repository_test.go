@@ -0,0 +1,117 @@
+package repo
+
+import (
+	"github.com/pc-power-api/src/infra/entity"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestClusterRepositoryPresences(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		cluster := NewClusterRepository(db)
+		now := time.Now()
+		for _, instance := range []struct {
+			id       string
+			lastSeen time.Time
+		}{{"alive", now}, {"stale", now.Add(-time.Hour)}} {
+			if aerr := cluster.Heartbeat(instance.id, instance.lastSeen); aerr != nil {
+				t.Fatal(aerr)
+			}
+		}
+		// A heartbeat of a known instance updates it
+		if aerr := cluster.Heartbeat("alive", now); aerr != nil {
+			t.Fatal(aerr)
+		}
+		for _, presence := range []entity.DevicePresence{
+			{DeviceID: "a", InstanceID: "alive", Status: 1},
+			{DeviceID: "b", InstanceID: "stale", Status: 1},
+			{DeviceID: "c", InstanceID: "stale", Status: 1},
+			{DeviceID: "c", InstanceID: "alive", Status: 2},
+		} {
+			if aerr := cluster.SavePresence(&presence); aerr != nil {
+				t.Fatal(aerr)
+			}
+		}
+
+		presences, aerr := cluster.GetPresences([]string{"a", "b", "c"}, now.Add(-time.Minute))
+		if aerr != nil {
+			t.Fatal(aerr)
+		}
+		if len(presences) != 2 {
+			t.Fatalf("expected the presences held by the alive instance, got %+v", presences)
+		}
+		for _, presence := range presences {
+			if presence.InstanceID != "alive" || (presence.DeviceID == "c" && presence.Status != 2) {
+				t.Fatalf("unexpected presence %+v", presence)
+			}
+		}
+
+		if aerr := cluster.DeletePresence("a", "stale"); aerr != nil {
+			t.Fatal(aerr)
+		}
+		if aerr := cluster.DeleteStaleInstances(now.Add(-time.Minute)); aerr != nil {
+			t.Fatal(aerr)
+		}
+		presences, aerr = cluster.GetPresences([]string{"a", "b", "c"}, now.Add(-2*time.Hour))
+		if aerr != nil {
+			t.Fatal(aerr)
+		}
+		if len(presences) != 2 {
+			t.Fatalf("expected the presence of the stale instance to be deleted, got %+v", presences)
+		}
+
+		if aerr := cluster.DeleteInstance("alive"); aerr != nil {
+			t.Fatal(aerr)
+		}
+		presences, aerr = cluster.GetPresences([]string{"a", "b", "c"}, time.Time{})
+		if aerr != nil || len(presences) != 0 {
+			t.Fatalf("expected no presence left, got %+v, %v", presences, aerr)
+		}
+	})
+}
+
+func TestClusterRepositoryMessages(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		cluster := NewClusterRepository(db)
+		if id, aerr := cluster.GetLastMessageId(); aerr != nil || id != 0 {
+			t.Fatalf("expected no message, got %d, %v", id, aerr)
+		}
+
+		old := &entity.ClusterMessage{CreatedAt: time.Now().Add(-time.Hour), Source: "a", Kind: entity.EventClusterMessage}
+		messages := []*entity.ClusterMessage{
+			old,
+			{Source: "a", Kind: entity.EventClusterMessage},
+			{Source: "a", Target: "b", Kind: entity.CommandClusterMessage},
+			{Source: "a", Target: "c", Kind: entity.CommandClusterMessage},
+			{Source: "b", Kind: entity.EventClusterMessage},
+		}
+		for _, message := range messages {
+			if aerr := cluster.CreateMessage(message); aerr != nil {
+				t.Fatal(aerr)
+			}
+		}
+
+		received, aerr := cluster.GetMessagesAfter(old.ID, "b")
+		if aerr != nil {
+			t.Fatal(aerr)
+		}
+		if len(received) != 2 || received[0].ID != messages[1].ID || received[1].ID != messages[2].ID {
+			t.Fatalf("expected the broadcast and the command sent to b, got %+v", received)
+		}
+		if id, aerr := cluster.GetLastMessageId(); aerr != nil || id != messages[4].ID {
+			t.Fatalf("expected the id of the last message, got %d, %v", id, aerr)
+		}
+
+		if aerr := cluster.DeleteMessagesBefore(time.Now().Add(-time.Minute)); aerr != nil {
+			t.Fatal(aerr)
+		}
+		received, aerr = cluster.GetMessagesAfter(0, "c")
+		if aerr != nil {
+			t.Fatal(aerr)
+		}
+		if len(received) != 3 || received[0].ID != messages[1].ID {
+			t.Fatalf("expected the old message to be deleted, got %+v", received)
+		}
+	})
+}
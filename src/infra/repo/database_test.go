@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"github.com/glebarez/sqlite"
+	"github.com/pc-power-api/src/infra/migration"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The MySQL and Postgres tests run against the databases given by these variables and are skipped when they are not
+// set. The databases are emptied by every test, never point them to a database holding data
+const MysqlDSNVariable = "TEST_MYSQL_DSN"
+const PostgresDSNVariable = "TEST_POSTGRES_DSN"
+
+// forEachDatabase runs the test against SQLite and against every database configured for the tests, each run starts
+// from a freshly migrated schema
+func forEachDatabase(t *testing.T, test func(t *testing.T, db *gorm.DB)) {
+	t.Run("sqlite", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.db")
+		test(t, openTestDatabase(t, sqlite.Open(path+"?_pragma=busy_timeout(5000)")))
+	})
+	t.Run("mysql", func(t *testing.T) {
+		dsn := os.Getenv(MysqlDSNVariable)
+		if dsn == "" {
+			t.Skipf("%s is not set", MysqlDSNVariable)
+		}
+		test(t, openTestDatabase(t, mysql.Open(dsn)))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv(PostgresDSNVariable)
+		if dsn == "" {
+			t.Skipf("%s is not set", PostgresDSNVariable)
+		}
+		test(t, openTestDatabase(t, postgres.Open(dsn)))
+	})
+}
+
+func openTestDatabase(t *testing.T, dialector gorm.Dialector) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(dialector, &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	// The shared databases still hold the schema of the previous test
+	migrator := migration.NewMigrator(db)
+	if _, aerr := migrator.Down(math.MaxInt); aerr != nil {
+		t.Fatal(aerr)
+	}
+	if _, aerr := migrator.Up(0); aerr != nil {
+		t.Fatal(aerr)
+	}
+	return db
+}
@@ -0,0 +1,146 @@
+package repo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const NameSort = "name"
+const CreatedAtSort = "created_at"
+const DefaultDeviceLimit = 50
+
+var InvalidCursorError = exceptions.NewUnsupportedOperation("the cursor is invalid or does not match the sort order")
+
+// DeviceQuery selects the devices of a user, Only restricts the result to the given ids when it is not nil
+type DeviceQuery struct {
+	UserID     string
+	Search     string
+	Tags       []string
+	Only       []string
+	Sort       string
+	Descending bool
+	Limit      int
+	Cursor     string
+}
+
+type DevicePage struct {
+	Devices    []entity.Device
+	Total      int64
+	NextCursor string
+}
+
+// deviceCursor is the position of the last device of a page in the sort order
+type deviceCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"i"`
+}
+
+// Find returns a page of the devices matching the query along with the number of matching devices
+func (r *DeviceRepository) Find(query *DeviceQuery) (*DevicePage, *errors.Error) {
+	page := &DevicePage{
+		Devices: make([]entity.Device, 0),
+	}
+	if query.Only != nil && len(query.Only) == 0 {
+		return page, nil
+	}
+	if query.Sort == "" {
+		query.Sort = NameSort
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultDeviceLimit
+	}
+
+	db := r.db.Model(&entity.Device{}).Where("user_id = ?", query.UserID)
+	if query.Search != "" {
+		db = db.Where("LOWER(name) LIKE ? ESCAPE '!'", "%"+escapeLike(strings.ToLower(query.Search))+"%")
+	}
+	if len(query.Tags) > 0 {
+		tagged := r.db.Model(&entity.DeviceTag{}).Select("device_id").Where("name IN ?", query.Tags).
+			Group("device_id").Having("COUNT(*) = ?", len(query.Tags))
+		db = db.Where("id IN (?)", tagged)
+	}
+	if query.Only != nil {
+		db = db.Where("id IN ?", query.Only)
+	}
+
+	err := db.Session(&gorm.Session{}).Count(&page.Total).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if query.Cursor != "" {
+		cursor, value, aerr := decodeDeviceCursor(query.Cursor, query.Sort)
+		if aerr != nil {
+			return nil, aerr
+		}
+		db = db.Where(query.Sort+" "+comparison+" ? OR ("+query.Sort+" = ? AND id "+comparison+" ?)", value, value, cursor.ID)
+	}
+
+	err = db.Preload("Tags").Order(query.Sort + " " + direction).Order("id " + direction).
+		Limit(query.Limit + 1).Find(&page.Devices).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	if len(page.Devices) > query.Limit {
+		page.Devices = page.Devices[:query.Limit]
+		page.NextCursor = encodeDeviceCursor(&page.Devices[query.Limit-1], query.Sort)
+	}
+	return page, nil
+}
+
+func (r *DeviceRepository) GetIdsByUserId(userId string) ([]string, *errors.Error) {
+	var ids []string
+	err := r.db.Model(&entity.Device{}).Where("user_id = ?", userId).Pluck("id", &ids).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return ids, nil
+}
+
+func encodeDeviceCursor(device *entity.Device, sort string) string {
+	cursor := deviceCursor{
+		Sort: sort,
+		ID:   device.ID,
+	}
+	if sort == CreatedAtSort {
+		cursor.Value = device.CreatedAt.Format(time.RFC3339Nano)
+	} else {
+		cursor.Value = device.Name
+	}
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeDeviceCursor(encoded string, sort string) (*deviceCursor, interface{}, *errors.Error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, errors.New(InvalidCursorError)
+	}
+	var cursor deviceCursor
+	if json.Unmarshal(raw, &cursor) != nil || cursor.Sort != sort {
+		return nil, nil, errors.New(InvalidCursorError)
+	}
+	if sort != CreatedAtSort {
+		return &cursor, cursor.Value, nil
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, cursor.Value)
+	if err != nil {
+		return nil, nil, errors.New(InvalidCursorError)
+	}
+	return &cursor, createdAt, nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(value)
+}
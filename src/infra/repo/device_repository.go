@@ -6,9 +6,15 @@ import (
 	"github.com/pc-power-api/src/exceptions"
 	"github.com/pc-power-api/src/infra/entity"
 	"gorm.io/gorm"
+	"time"
 )
 
 var DeviceNotFoundError = exceptions.NewObjectNotFound("device not found")
+var ChannelAlreadyExistsError = exceptions.NewObjectAlreadyExist("this channel is already assigned to a device")
+var ChannelInTrashError = exceptions.NewObjectAlreadyExist("this channel is assigned to a device in the trash, restore or purge it first")
+var ChannelOutOfRangeError = exceptions.NewUnsupportedOperation("the relay board does not have this channel")
+var ChannelsInUseError = exceptions.NewUnsupportedOperation("the relay board has channels beyond its new number of channels, delete them first")
+var RelayBoardInTrashError = exceptions.NewUnsupportedOperation("the relay board of this channel must be restored first")
 
 type DeviceRepository struct {
 	db *gorm.DB
@@ -20,33 +26,320 @@ func NewDeviceRepository(db *gorm.DB) *DeviceRepository {
 	}
 }
 
-func (r *DeviceRepository) Create(device *entity.Device) *errors.Error {
-	err := r.db.Create(device).Error
+// Create counts the devices of the owner for the check in the transaction inserting the device
+func (r *DeviceRepository) Create(device *entity.Device, check CountCheck) *errors.Error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkDeviceCount(tx, device.UserID, check); err != nil {
+			return err
+		}
+		return tx.Create(device).Error
+	})
 	if err != nil {
 		return errors.New(err)
 	}
 	return nil
 }
 
+// Update saves the device and replaces its tags, the number of channels of a relay board cannot be lowered below the
+// channels in use
 func (r *DeviceRepository) Update(device *entity.Device) *errors.Error {
-	err := r.db.Save(device).Error
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if device.ParentID == nil {
+			if err := lockDevice(tx, device.ID); err != nil {
+				return err
+			}
+			var count int64
+			err := tx.Model(&entity.Device{}).Where("parent_id = ? AND channel >= ?", device.ID, device.Channels).Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return ChannelsInUseError
+			}
+		}
+		err := tx.Where("device_id = ?", device.ID).Delete(&entity.DeviceTag{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Save(device).Error
+	})
 	if err != nil {
 		return errors.New(err)
 	}
 	return nil
 }
 
+// Delete moves the device to the trash along with its channels when it is a relay board, they share the same deletion
+// time so that they can be restored together
 func (r *DeviceRepository) Delete(device *entity.Device) *errors.Error {
-	err := r.db.Delete(device).Error
+	now := time.Now()
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entity.Device{}).Where("parent_id = ?", device.ID).Update("deleted_at", now).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("device_id = ?", device.ID).Delete(&entity.DeviceTransfer{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(device).Update("deleted_at", now).Error
+	})
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *DeviceRepository) GetTrashByUserId(userId string) ([]entity.Device, *errors.Error) {
+	var devices []entity.Device
+	err := r.db.Unscoped().Preload("Tags").Where("user_id = ? AND deleted_at IS NOT NULL", userId).Order("deleted_at DESC").Find(&devices).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return devices, nil
+}
+
+func (r *DeviceRepository) GetTrashedById(id string) (*entity.Device, *errors.Error) {
+	var device entity.Device
+	err := r.db.Unscoped().Preload("Tags").Where("id = ? AND deleted_at IS NOT NULL", id).First(&device).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New(DeviceNotFoundError)
+		}
+		return nil, errors.New(err)
+	}
+	return &device, nil
+}
+
+// Restore takes the device out of the trash with the channels that were deleted along with it, a channel can only be
+// restored while its relay board exists and still has its channel. The check only applies to the devices other than
+// the channels
+func (r *DeviceRepository) Restore(device *entity.Device, check CountCheck) *errors.Error {
+	deletedAt := device.DeletedAt
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if device.ParentID == nil {
+			if err := checkDeviceCount(tx, device.UserID, check); err != nil {
+				return err
+			}
+		} else {
+			if err := checkChannelRange(tx, device); err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return RelayBoardInTrashError
+				}
+				return err
+			}
+		}
+
+		err := tx.Unscoped().Model(&entity.Device{}).Where("parent_id = ? AND deleted_at = ?", device.ID, deletedAt).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		device.DeletedAt = gorm.DeletedAt{}
+		return tx.Unscoped().Save(device).Error
+	})
+	if err != nil {
+		device.DeletedAt = deletedAt
+		return errors.New(err)
+	}
+	return nil
+}
+
+// Purge permanently deletes a trashed device with its channels and the configuration attached to them
+func (r *DeviceRepository) Purge(device *entity.Device) *errors.Error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		return purge(tx, device.ID)
+	})
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+// PurgeDeletedBefore permanently deletes the devices trashed before the given time, it returns how many were purged
+func (r *DeviceRepository) PurgeDeletedBefore(before time.Time) (int, *errors.Error) {
+	var ids []string
+	err := r.db.Unscoped().Model(&entity.Device{}).Where("deleted_at < ? AND parent_id IS NULL", before).Pluck("id", &ids).Error
+	if err != nil {
+		return 0, errors.New(err)
+	}
+	var channelIds []string
+	err = r.db.Unscoped().Model(&entity.Device{}).Where("deleted_at < ? AND parent_id IS NOT NULL", before).Pluck("id", &channelIds).Error
+	if err != nil {
+		return 0, errors.New(err)
+	}
+	ids = append(channelIds, ids...)
+
+	purged := 0
+	for _, id := range ids {
+		err = r.db.Transaction(func(tx *gorm.DB) error {
+			return purge(tx, id)
+		})
+		if err != nil {
+			return purged, errors.New(err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// checkDeviceCount runs the check, if any, against the number of devices of the user, the channels are not counted
+func checkDeviceCount(tx *gorm.DB, userId string, check CountCheck) error {
+	if check == nil {
+		return nil
+	}
+	if err := lockUser(tx, userId); err != nil {
+		return err
+	}
+	var count int64
+	err := tx.Model(&entity.Device{}).Where("user_id = ? AND parent_id IS NULL", userId).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if aerr := check(count); aerr != nil {
+		return aerr.Err
+	}
+	return nil
+}
+
+func purge(tx *gorm.DB, deviceId string) error {
+	var ids []string
+	err := tx.Unscoped().Model(&entity.Device{}).Where("parent_id = ?", deviceId).Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+	ids = append(ids, deviceId)
+
+	watchdogs := tx.Model(&entity.Watchdog{}).Select("id").Where("device_id IN ?", ids)
+	err = tx.Where("watchdog_id IN (?)", watchdogs).Delete(&entity.WatchdogStep{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("device_id IN ?", ids).Delete(&entity.Watchdog{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("device_id IN ?", ids).Delete(&entity.WolTarget{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("trigger_device_id IN ? OR action_device_id IN ?", ids, ids).Delete(&entity.Automation{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("device_id IN ?", ids).Delete(&entity.MacroStep{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("device_id IN ?", ids).Delete(&entity.DeviceTag{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("device_id IN ?", ids).Delete(&entity.DeviceTransfer{}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(&entity.Device{}).Error
+}
+
+// CreateChannel creates the logical device of a channel, failing if the channel is already in use on the board. A
+// channel in the trash keeps its slot until it is purged, the unique index on the slot settles the concurrent creations
+func (r *DeviceRepository) CreateChannel(device *entity.Device) *errors.Error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkChannelRange(tx, device); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return DeviceNotFoundError
+			}
+			return err
+		}
+		var existing []entity.Device
+		err := tx.Unscoped().Where("parent_id = ? AND channel = ?", device.ParentID, device.Channel).Find(&existing).Error
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			if existing[0].DeletedAt.Valid {
+				return ChannelInTrashError
+			}
+			return ChannelAlreadyExistsError
+		}
+		err = tx.Create(device).Error
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ChannelAlreadyExistsError
+		}
+		return err
+	})
 	if err != nil {
 		return errors.New(err)
 	}
 	return nil
 }
 
+// checkChannelRange locks the relay board of the channel and fails when the board does not have the channel, the lock
+// keeps the number of channels from being lowered meanwhile
+func checkChannelRange(tx *gorm.DB, channel *entity.Device) error {
+	if err := lockDevice(tx, *channel.ParentID); err != nil {
+		return err
+	}
+	var board entity.Device
+	err := tx.Select("channels").Where("id = ?", channel.ParentID).First(&board).Error
+	if err != nil {
+		return err
+	}
+	if channel.Channel >= board.Channels {
+		return ChannelOutOfRangeError
+	}
+	return nil
+}
+
+// lockDevice makes the transactions changing the channels of a relay board wait for each other, the same way as
+// lockUser
+func lockDevice(tx *gorm.DB, deviceId string) error {
+	return tx.Model(&entity.Device{}).Where("id = ?", deviceId).UpdateColumn("id", gorm.Expr("id")).Error
+}
+
+// CountByUserId returns the number of devices of the user, the channels of the relay boards are not counted
+func (r *DeviceRepository) CountByUserId(userId string) (int64, *errors.Error) {
+	var count int64
+	err := r.db.Model(&entity.Device{}).Where("user_id = ? AND parent_id IS NULL", userId).Count(&count).Error
+	if err != nil {
+		return 0, errors.New(err)
+	}
+	return count, nil
+}
+
+// GetAll returns the devices of every user, the relay boards before their channels
+func (r *DeviceRepository) GetAll() ([]entity.Device, *errors.Error) {
+	var devices []entity.Device
+	err := r.db.Order("user_id, parent_id IS NOT NULL, name").Find(&devices).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return devices, nil
+}
+
+// Count returns the number of devices of every user, the channels and the devices in the trash are not counted
+func (r *DeviceRepository) Count() (int64, *errors.Error) {
+	var count int64
+	err := r.db.Model(&entity.Device{}).Where("parent_id IS NULL").Count(&count).Error
+	if err != nil {
+		return 0, errors.New(err)
+	}
+	return count, nil
+}
+
+func (r *DeviceRepository) GetChannels(parentId string) ([]entity.Device, *errors.Error) {
+	var devices []entity.Device
+	err := r.db.Where("parent_id = ?", parentId).Order("channel").Find(&devices).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return devices, nil
+}
+
 func (r *DeviceRepository) GetById(id string) (*entity.Device, *errors.Error) {
 	var device entity.Device
-	err := r.db.Where("id = ?", id).First(&device).Error
+	err := r.db.Preload("Tags").Where("id = ?", id).First(&device).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New(DeviceNotFoundError)
@@ -0,0 +1,310 @@
+package repo
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
+	"gorm.io/gorm"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func createDevice(t *testing.T, db *gorm.DB, user *entity.User, name string, tags ...string) *entity.Device {
+	t.Helper()
+	code := uuid.New().String()
+	device := &entity.Device{
+		ID:     uuid.New().String(),
+		Name:   name,
+		Code:   &code,
+		Secret: "secret",
+		UserID: user.ID,
+	}
+	device.SetTags(tags)
+	if aerr := NewDeviceRepository(db).Create(device, nil); aerr != nil {
+		t.Fatal(aerr)
+	}
+	return device
+}
+
+func createChannel(t *testing.T, db *gorm.DB, board *entity.Device, channel int) *entity.Device {
+	t.Helper()
+	if board.Channels <= channel {
+		board.Channels = channel + 1
+		if err := db.Model(board).Update("channels", board.Channels).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	device := &entity.Device{
+		ID:       uuid.New().String(),
+		Name:     fmt.Sprintf("%s %d", board.Name, channel),
+		UserID:   board.UserID,
+		ParentID: &board.ID,
+		Channel:  channel,
+	}
+	if aerr := NewDeviceRepository(db).CreateChannel(device); aerr != nil {
+		t.Fatal(aerr)
+	}
+	return device
+}
+
+// findAll follows the cursors until the last page
+func findAll(t *testing.T, devices *DeviceRepository, query DeviceQuery) ([]string, int64) {
+	t.Helper()
+	var names []string
+	var total int64
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatal("the pagination does not end")
+		}
+		page, aerr := devices.Find(&query)
+		if aerr != nil {
+			t.Fatal(aerr)
+		}
+		for _, device := range page.Devices {
+			names = append(names, device.Name)
+		}
+		total = page.Total
+		if page.NextCursor == "" {
+			return names, total
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+func TestDeviceRepositoryFind(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		devices := NewDeviceRepository(db)
+		alice := createUser(t, db, "alice")
+		bob := createUser(t, db, "bob")
+		for _, name := range []string{"nas", "desktop", "laptop", "desktop", "media_center", "Office PC", "desktop"} {
+			createDevice(t, db, alice, name, "home")
+		}
+		createDevice(t, db, alice, "server", "home", "rack")
+		createDevice(t, db, alice, "switch", "rack")
+		createDevice(t, db, bob, "bob's desktop")
+
+		t.Run("pages follow the sort order", func(t *testing.T) {
+			for _, sort := range []string{NameSort, CreatedAtSort} {
+				for _, descending := range []bool{false, true} {
+					query := DeviceQuery{UserID: alice.ID, Sort: sort, Descending: descending}
+					expected, total := findAll(t, devices, query)
+					if len(expected) != 9 || total != 9 {
+						t.Fatalf("expected the 9 devices of alice, got %d out of %d", len(expected), total)
+					}
+					for _, limit := range []int{1, 2, 4} {
+						query.Limit = limit
+						names, total := findAll(t, devices, query)
+						if !slices.Equal(names, expected) || total != 9 {
+							t.Fatalf("%s descending=%v limit=%d: got %v (%d), expected %v", sort, descending, limit, names, total, expected)
+						}
+					}
+				}
+			}
+		})
+
+		t.Run("filters", func(t *testing.T) {
+			names, total := findAll(t, devices, DeviceQuery{UserID: alice.ID, Search: "DESK", Limit: 2})
+			if total != 3 || len(names) != 3 {
+				t.Fatalf("expected the 3 desktops, got %v (%d)", names, total)
+			}
+			names, total = findAll(t, devices, DeviceQuery{UserID: alice.ID, Search: "a%c"})
+			if total != 0 {
+				t.Fatalf("the wildcards were not escaped: %v", names)
+			}
+			names, _ = findAll(t, devices, DeviceQuery{UserID: alice.ID, Tags: []string{"home", "rack"}})
+			if !slices.Equal(names, []string{"server"}) {
+				t.Fatalf("expected the devices having both tags, got %v", names)
+			}
+			page, aerr := devices.Find(&DeviceQuery{UserID: alice.ID, Only: []string{}})
+			if aerr != nil || len(page.Devices) != 0 || page.Total != 0 {
+				t.Fatalf("expected no device, got %+v, %v", page, aerr)
+			}
+		})
+
+		t.Run("invalid cursor", func(t *testing.T) {
+			page, aerr := devices.Find(&DeviceQuery{UserID: alice.ID, Limit: 1})
+			if aerr != nil {
+				t.Fatal(aerr)
+			}
+			_, aerr = devices.Find(&DeviceQuery{UserID: alice.ID, Sort: CreatedAtSort, Cursor: page.NextCursor})
+			if !errors.Is(aerr, InvalidCursorError) {
+				t.Fatalf("expected the cursor of another sort order to be refused, got %v", aerr)
+			}
+			_, aerr = devices.Find(&DeviceQuery{UserID: alice.ID, Cursor: "not a cursor"})
+			if !errors.Is(aerr, InvalidCursorError) {
+				t.Fatalf("expected the cursor to be refused, got %v", aerr)
+			}
+		})
+	})
+}
+
+func TestDeviceRepositoryTrash(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		devices := NewDeviceRepository(db)
+		alice := createUser(t, db, "alice")
+		board := createDevice(t, db, alice, "board")
+		channel := createChannel(t, db, board, 1)
+		other := createChannel(t, db, board, 2)
+
+		duplicate := &entity.Device{ID: uuid.New().String(), UserID: alice.ID, ParentID: &board.ID, Channel: 1}
+		if aerr := devices.CreateChannel(duplicate); !errors.Is(aerr, ChannelAlreadyExistsError) {
+			t.Fatalf("expected the channel to be in use, got %v", aerr)
+		}
+		if count, aerr := devices.CountByUserId(alice.ID); aerr != nil || count != 1 {
+			t.Fatalf("expected the channels not to be counted, got %d, %v", count, aerr)
+		}
+
+		// The channel deleted on its own stays in the trash when the board is restored
+		if aerr := devices.Delete(other); aerr != nil {
+			t.Fatal(aerr)
+		}
+		if aerr := devices.Delete(board); aerr != nil {
+			t.Fatal(aerr)
+		}
+		trashed, aerr := devices.GetTrashedById(channel.ID)
+		if aerr != nil {
+			t.Fatal(aerr)
+		}
+		if aerr := devices.Restore(trashed, nil); !errors.Is(aerr, RelayBoardInTrashError) {
+			t.Fatalf("expected the board to be required, got %v", aerr)
+		}
+		trashed, aerr = devices.GetTrashedById(board.ID)
+		if aerr != nil {
+			t.Fatal(aerr)
+		}
+		if aerr := devices.Restore(trashed, nil); aerr != nil {
+			t.Fatal(aerr)
+		}
+		channels, aerr := devices.GetChannels(board.ID)
+		if aerr != nil {
+			t.Fatal(aerr)
+		}
+		if len(channels) != 1 || channels[0].ID != channel.ID {
+			t.Fatalf("expected only the channel deleted with the board to be restored, got %+v", channels)
+		}
+
+		automation := &entity.Automation{ID: uuid.New().String(), UserID: alice.ID, TriggerDeviceID: board.ID, ActionDeviceID: other.ID}
+		if err := db.Create(automation).Error; err != nil {
+			t.Fatal(err)
+		}
+		macro := &entity.Macro{ID: uuid.New().String(), UserID: alice.ID, Steps: []entity.MacroStep{
+			{Position: 0, Type: entity.CommandStep, DeviceID: other.ID},
+			{Position: 1, Type: entity.CommandStep, DeviceID: channel.ID},
+		}}
+		if err := db.Create(macro).Error; err != nil {
+			t.Fatal(err)
+		}
+		purged, aerr := devices.PurgeDeletedBefore(time.Now().Add(time.Hour))
+		if aerr != nil {
+			t.Fatal(aerr)
+		}
+		if purged != 1 {
+			t.Fatalf("expected the trashed channel to be purged, got %d", purged)
+		}
+		var automations int64
+		if err := db.Model(&entity.Automation{}).Count(&automations).Error; err != nil {
+			t.Fatal(err)
+		}
+		var steps []entity.MacroStep
+		if err := db.Where("macro_id = ?", macro.ID).Find(&steps).Error; err != nil {
+			t.Fatal(err)
+		}
+		if automations != 0 || len(steps) != 1 || steps[0].DeviceID != channel.ID {
+			t.Fatalf("expected the automation and the macro step using the purged channel to be removed, got %d and %+v", automations, steps)
+		}
+		trash, aerr := devices.GetTrashByUserId(alice.ID)
+		if aerr != nil || len(trash) != 0 {
+			t.Fatalf("expected the trash to be empty, got %+v, %v", trash, aerr)
+		}
+	})
+}
+
+func TestDeviceRepositoryChannels(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		devices := NewDeviceRepository(db)
+		alice := createUser(t, db, "alice")
+		board := createDevice(t, db, alice, "board")
+		first := createChannel(t, db, board, 0)
+		second := createChannel(t, db, board, 1)
+		if first.Code != nil || second.Code != nil || first.Secret != "" {
+			t.Fatalf("expected the channels to have no credentials, got %+v", first)
+		}
+
+		outOfRange := &entity.Device{ID: uuid.New().String(), UserID: alice.ID, ParentID: &board.ID, Channel: board.Channels}
+		if aerr := devices.CreateChannel(outOfRange); !errors.Is(aerr, ChannelOutOfRangeError) {
+			t.Fatalf("expected the channel to be out of range, got %v", aerr)
+		}
+
+		board.Channels = 1
+		if aerr := devices.Update(board); !errors.Is(aerr, ChannelsInUseError) {
+			t.Fatalf("expected the channel in use to keep the board from shrinking, got %v", aerr)
+		}
+		if aerr := devices.Delete(second); aerr != nil {
+			t.Fatal(aerr)
+		}
+		replacement := &entity.Device{ID: uuid.New().String(), UserID: alice.ID, ParentID: &board.ID, Channel: 1}
+		if aerr := devices.CreateChannel(replacement); !errors.Is(aerr, ChannelInTrashError) {
+			t.Fatalf("expected the trashed channel to keep its slot, got %v", aerr)
+		}
+		if aerr := devices.Update(board); aerr != nil {
+			t.Fatal(aerr)
+		}
+		trashed, aerr := devices.GetTrashedById(second.ID)
+		if aerr != nil {
+			t.Fatal(aerr)
+		}
+		if aerr := devices.Restore(trashed, nil); !errors.Is(aerr, ChannelOutOfRangeError) {
+			t.Fatalf("expected the channel removed from the board not to be restored, got %v", aerr)
+		}
+
+		duplicate := &entity.Device{ID: uuid.New().String(), UserID: alice.ID, ParentID: &board.ID, Channel: 1}
+		if err := db.Create(duplicate).Error; !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Fatalf("expected the slot to be unique, got %v", err)
+		}
+	})
+}
+
+func TestDeviceRepositoryCreateWithinLimit(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		devices := NewDeviceRepository(db)
+		alice := createUser(t, db, "alice")
+		limitReached := exceptions.NewLimitExceeded("the limit of 3 devices has been reached", 0)
+		check := func(count int64) *errors.Error {
+			if count >= 3 {
+				return errors.New(limitReached)
+			}
+			return nil
+		}
+
+		// The creations racing for the last slots must not go over the limit
+		var created atomic.Int32
+		wg := sync.WaitGroup{}
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				device := &entity.Device{ID: uuid.New().String(), UserID: alice.ID}
+				aerr := devices.Create(device, check)
+				if aerr == nil {
+					created.Add(1)
+				} else if !errors.Is(aerr, limitReached) {
+					t.Error(aerr)
+				}
+			}()
+		}
+		wg.Wait()
+
+		count, aerr := devices.CountByUserId(alice.ID)
+		if aerr != nil {
+			t.Fatal(aerr)
+		}
+		if created.Load() != 3 || count != 3 {
+			t.Fatalf("expected 3 devices, %d were created and %d are stored", created.Load(), count)
+		}
+	})
+}
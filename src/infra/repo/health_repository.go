@@ -0,0 +1,29 @@
+package repo
+
+import (
+	"context"
+	"github.com/go-errors/errors"
+	"gorm.io/gorm"
+)
+
+type HealthRepository struct {
+	db *gorm.DB
+}
+
+func NewHealthRepository(db *gorm.DB) *HealthRepository {
+	return &HealthRepository{
+		db: db,
+	}
+}
+
+func (r *HealthRepository) Ping(ctx context.Context) *errors.Error {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return errors.New(err)
+	}
+	err = sqlDB.PingContext(ctx)
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
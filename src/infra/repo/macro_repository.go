@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
+	"gorm.io/gorm"
+)
+
+var MacroNotFoundError = exceptions.NewObjectNotFound("macro not found")
+
+type MacroRepository struct {
+	db *gorm.DB
+}
+
+func NewMacroRepository(db *gorm.DB) *MacroRepository {
+	return &MacroRepository{
+		db: db,
+	}
+}
+
+func (r *MacroRepository) Create(macro *entity.Macro) *errors.Error {
+	err := r.db.Create(macro).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+// Update replaces the macro along with all of its steps
+func (r *MacroRepository) Update(macro *entity.Macro) *errors.Error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("macro_id = ?", macro.ID).Delete(&entity.MacroStep{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Save(macro).Error
+	})
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *MacroRepository) Delete(macro *entity.Macro) *errors.Error {
+	err := r.db.Select("Steps").Delete(macro).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *MacroRepository) GetById(id string) (*entity.Macro, *errors.Error) {
+	var macro entity.Macro
+	err := r.db.Preload("Steps", orderStepsByPosition).Where("id = ?", id).First(&macro).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New(MacroNotFoundError)
+		}
+		return nil, errors.New(err)
+	}
+	return &macro, nil
+}
+
+func (r *MacroRepository) GetByUserId(userId string) ([]entity.Macro, *errors.Error) {
+	var macros []entity.Macro
+	err := r.db.Preload("Steps", orderStepsByPosition).Where("user_id = ?", userId).Order("created_at").Find(&macros).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return macros, nil
+}
@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
+	"gorm.io/gorm"
+	"time"
+)
+
+var MacroRunNotFoundError = exceptions.NewObjectNotFound("macro run not found")
+
+type MacroRunRepository struct {
+	db *gorm.DB
+}
+
+func NewMacroRunRepository(db *gorm.DB) *MacroRunRepository {
+	return &MacroRunRepository{
+		db: db,
+	}
+}
+
+func (r *MacroRunRepository) Create(run *entity.MacroRun) *errors.Error {
+	err := r.db.Create(run).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+// Save records the progress of the run and of every one of its steps
+func (r *MacroRunRepository) Save(run *entity.MacroRun) *errors.Error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit("Steps").Save(run).Error
+		if err != nil {
+			return err
+		}
+		return tx.Save(&run.Steps).Error
+	})
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *MacroRunRepository) GetById(id string) (*entity.MacroRun, *errors.Error) {
+	var run entity.MacroRun
+	err := r.db.Preload("Steps", orderStepsByPosition).Where("id = ?", id).First(&run).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New(MacroRunNotFoundError)
+		}
+		return nil, errors.New(err)
+	}
+	return &run, nil
+}
+
+// DeleteFinishedBefore removes the runs that ended before the given time
+func (r *MacroRunRepository) DeleteFinishedBefore(before time.Time) *errors.Error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		runs := tx.Model(&entity.MacroRun{}).Select("id").Where("finished_at < ?", before)
+		err := tx.Where("macro_run_id IN (?)", runs).Delete(&entity.MacroRunStep{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("finished_at < ?", before).Delete(&entity.MacroRun{}).Error
+	})
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package repo
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/infra/entity"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestMacroRunRepository(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		runs := NewMacroRunRepository(db)
+		run := &entity.MacroRun{ID: uuid.New().String(), UserID: uuid.New().String(), MacroID: uuid.New().String(), Status: "running", StartedAt: time.Now(), Steps: []entity.MacroRunStep{
+			{Position: 0, Type: entity.DelayStep, Status: "pending"},
+			{Position: 1, Type: entity.DelayStep, Status: "pending"},
+		}}
+		run.Steps[0].MacroRunID = run.ID
+		run.Steps[1].MacroRunID = run.ID
+		if aerr := runs.Create(run); aerr != nil {
+			t.Fatal(aerr)
+		}
+
+		t.Run("save", func(t *testing.T) {
+			finishedAt := time.Now()
+			run.Status = "failed"
+			run.FinishedAt = &finishedAt
+			run.Steps[0].Status = "failed"
+			run.Steps[0].Error = "interrupted"
+			run.Steps[1].Status = "skipped"
+			if aerr := runs.Save(run); aerr != nil {
+				t.Fatal(aerr)
+			}
+			saved, aerr := runs.GetById(run.ID)
+			if aerr != nil {
+				t.Fatal(aerr)
+			}
+			if saved.Status != "failed" || saved.FinishedAt == nil || len(saved.Steps) != 2 ||
+				saved.Steps[0].Error != "interrupted" || saved.Steps[1].Status != "skipped" {
+				t.Fatalf("the progress of the run was not saved %+v", saved)
+			}
+		})
+
+		t.Run("prune", func(t *testing.T) {
+			if aerr := runs.DeleteFinishedBefore(run.FinishedAt.Add(-time.Minute)); aerr != nil {
+				t.Fatal(aerr)
+			}
+			if _, aerr := runs.GetById(run.ID); aerr != nil {
+				t.Fatalf("expected the recent run to be kept, got %v", aerr)
+			}
+			if aerr := runs.DeleteFinishedBefore(run.FinishedAt.Add(time.Minute)); aerr != nil {
+				t.Fatal(aerr)
+			}
+			if _, aerr := runs.GetById(run.ID); !errors.Is(aerr, MacroRunNotFoundError) {
+				t.Fatalf("expected the run to be pruned, got %v", aerr)
+			}
+			var steps int64
+			if err := db.Model(&entity.MacroRunStep{}).Count(&steps).Error; err != nil {
+				t.Fatal(err)
+			}
+			if steps != 0 {
+				t.Fatalf("expected the steps of the run to be pruned, %d are left", steps)
+			}
+		})
+	})
+}
@@ -0,0 +1,110 @@
+package repo
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/infra/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+const SnapshotVersion = 1
+const snapshotBatchSize = 100
+
+var UnsupportedSnapshotError = errors.Errorf("the snapshot version is not supported")
+
+// Snapshot holds every row of the tables describing the accounts, the devices in the trash included. The pending
+// transfers and the cluster state are left out since they do not outlive a restart
+type Snapshot struct {
+	Version       int
+	ExportedAt    time.Time
+	Users         []entity.User
+	Devices       []entity.Device
+	DeviceTags    []entity.DeviceTag
+	Watchdogs     []entity.Watchdog
+	WatchdogSteps []entity.WatchdogStep
+	Automations   []entity.Automation
+	Macros        []entity.Macro
+	MacroSteps    []entity.MacroStep
+	WolTargets    []entity.WolTarget
+	AuditEntries  []entity.AuditEntry
+}
+
+type SnapshotRepository struct {
+	db *gorm.DB
+}
+
+func NewSnapshotRepository(db *gorm.DB) *SnapshotRepository {
+	return &SnapshotRepository{
+		db: db,
+	}
+}
+
+func (r *SnapshotRepository) Export() (*Snapshot, *errors.Error) {
+	snapshot := &Snapshot{
+		Version:    SnapshotVersion,
+		ExportedAt: time.Now(),
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// The relay boards come before their channels so that the import can follow the same order
+		tables := []struct {
+			rows  interface{}
+			order string
+		}{
+			{&snapshot.Users, "created_at"},
+			{&snapshot.Devices, "parent_id IS NOT NULL, created_at"},
+			{&snapshot.DeviceTags, "device_id, name"},
+			{&snapshot.Watchdogs, "created_at"},
+			{&snapshot.WatchdogSteps, "id"},
+			{&snapshot.Automations, "created_at"},
+			{&snapshot.Macros, "created_at"},
+			{&snapshot.MacroSteps, "id"},
+			{&snapshot.WolTargets, "created_at"},
+			{&snapshot.AuditEntries, "created_at"},
+		}
+		for _, table := range tables {
+			err := tx.Unscoped().Order(table.order).Find(table.rows).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return snapshot, nil
+}
+
+// Import inserts the rows of the snapshot in a single transaction, nothing is imported if one of them conflicts
+// with the existing data
+func (r *SnapshotRepository) Import(snapshot *Snapshot) *errors.Error {
+	if snapshot.Version != SnapshotVersion {
+		return errors.New(UnsupportedSnapshotError)
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		tables := []interface{}{
+			snapshot.Users,
+			snapshot.Devices,
+			snapshot.DeviceTags,
+			snapshot.Watchdogs,
+			snapshot.WatchdogSteps,
+			snapshot.Automations,
+			snapshot.Macros,
+			snapshot.MacroSteps,
+			snapshot.WolTargets,
+			snapshot.AuditEntries,
+		}
+		for _, rows := range tables {
+			err := tx.Omit(clause.Associations).CreateInBatches(rows, snapshotBatchSize).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
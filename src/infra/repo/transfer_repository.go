@@ -0,0 +1,154 @@
+package repo
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
+	"gorm.io/gorm"
+	"time"
+)
+
+var TransferNotFoundError = exceptions.NewObjectNotFound("no pending transfer was found")
+
+type TransferRepository struct {
+	db *gorm.DB
+}
+
+func NewTransferRepository(db *gorm.DB) *TransferRepository {
+	return &TransferRepository{
+		db: db,
+	}
+}
+
+// Create replaces the pending transfer of the device if there is one
+func (r *TransferRepository) Create(transfer *entity.DeviceTransfer) *errors.Error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("device_id = ?", transfer.DeviceID).Delete(&entity.DeviceTransfer{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(transfer).Error
+	})
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *TransferRepository) Delete(transfer *entity.DeviceTransfer) *errors.Error {
+	err := r.db.Delete(transfer).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+// GetById only returns the transfers that have not expired
+func (r *TransferRepository) GetById(id string) (*entity.DeviceTransfer, *errors.Error) {
+	var transfer entity.DeviceTransfer
+	err := r.db.Where("id = ? AND expires_at > ?", id, time.Now()).First(&transfer).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New(TransferNotFoundError)
+		}
+		return nil, errors.New(err)
+	}
+	return &transfer, nil
+}
+
+func (r *TransferRepository) GetByDeviceId(deviceId string) (*entity.DeviceTransfer, *errors.Error) {
+	var transfer entity.DeviceTransfer
+	err := r.db.Where("device_id = ? AND expires_at > ?", deviceId, time.Now()).First(&transfer).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New(TransferNotFoundError)
+		}
+		return nil, errors.New(err)
+	}
+	return &transfer, nil
+}
+
+func (r *TransferRepository) GetIncoming(userId string) ([]entity.DeviceTransfer, *errors.Error) {
+	return r.getPending("to_user_id = ?", userId)
+}
+
+func (r *TransferRepository) GetOutgoing(userId string) ([]entity.DeviceTransfer, *errors.Error) {
+	return r.getPending("from_user_id = ?", userId)
+}
+
+func (r *TransferRepository) getPending(condition string, userId string) ([]entity.DeviceTransfer, *errors.Error) {
+	var transfers []entity.DeviceTransfer
+	err := r.db.Where(condition, userId).Where("expires_at > ?", time.Now()).
+		Order("created_at").Find(&transfers).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return transfers, nil
+}
+
+// Accept gives the device and its channels to the recipient with a new secret. The automations and the macro steps
+// of the previous owner using them are removed, the watchdog and the wake-on-lan targets too when requested. The check
+// is given the number of devices of the recipient
+func (r *TransferRepository) Accept(transfer *entity.DeviceTransfer, secret string, check CountCheck) *errors.Error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND expires_at > ?", transfer.ID, time.Now()).Delete(&entity.DeviceTransfer{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return TransferNotFoundError
+		}
+		if err := checkDeviceCount(tx, transfer.ToUserID, check); err != nil {
+			return err
+		}
+
+		var ids []string
+		err := tx.Model(&entity.Device{}).Where("parent_id = ?", transfer.DeviceID).Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		ids = append(ids, transfer.DeviceID)
+
+		result = tx.Model(&entity.Device{}).Where("id IN ? AND user_id = ?", ids, transfer.FromUserID).
+			Update("user_id", transfer.ToUserID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != int64(len(ids)) {
+			return TransferNotFoundError
+		}
+		err = tx.Model(&entity.Device{}).Where("id = ?", transfer.DeviceID).Update("secret", secret).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("user_id = ? AND (trigger_device_id IN ? OR action_device_id IN ?)", transfer.FromUserID, ids, ids).
+			Delete(&entity.Automation{}).Error
+		if err != nil {
+			return err
+		}
+		macros := tx.Model(&entity.Macro{}).Select("id").Where("user_id = ?", transfer.FromUserID)
+		err = tx.Where("macro_id IN (?) AND device_id IN ?", macros, ids).Delete(&entity.MacroStep{}).Error
+		if err != nil {
+			return err
+		}
+
+		if !transfer.ClearConfiguration {
+			return nil
+		}
+		watchdogs := tx.Model(&entity.Watchdog{}).Select("id").Where("device_id IN ?", ids)
+		err = tx.Where("watchdog_id IN (?)", watchdogs).Delete(&entity.WatchdogStep{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("device_id IN ?", ids).Delete(&entity.Watchdog{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("device_id IN ?", ids).Delete(&entity.WolTarget{}).Error
+	})
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package repo
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/infra/entity"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func createTransfer(t *testing.T, db *gorm.DB, device *entity.Device, to *entity.User, expiresAt time.Time) *entity.DeviceTransfer {
+	t.Helper()
+	transfer := &entity.DeviceTransfer{
+		ID:         uuid.New().String(),
+		ExpiresAt:  expiresAt,
+		DeviceID:   device.ID,
+		FromUserID: device.UserID,
+		ToUserID:   to.ID,
+	}
+	if aerr := NewTransferRepository(db).Create(transfer); aerr != nil {
+		t.Fatal(aerr)
+	}
+	return transfer
+}
+
+func TestTransferRepository(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		transfers := NewTransferRepository(db)
+		devices := NewDeviceRepository(db)
+		alice := createUser(t, db, "alice")
+		bob := createUser(t, db, "bob")
+		carol := createUser(t, db, "carol")
+		board := createDevice(t, db, alice, "board")
+		channel := createChannel(t, db, board, 1)
+		lamp := createDevice(t, db, alice, "lamp")
+
+		automation := &entity.Automation{ID: uuid.New().String(), UserID: alice.ID, TriggerDeviceID: lamp.ID, ActionDeviceID: channel.ID}
+		if err := db.Create(automation).Error; err != nil {
+			t.Fatal(err)
+		}
+		macro := &entity.Macro{ID: uuid.New().String(), UserID: alice.ID, Steps: []entity.MacroStep{
+			{Position: 0, Type: entity.CommandStep, DeviceID: channel.ID},
+			{Position: 1, Type: entity.CommandStep, DeviceID: lamp.ID},
+		}}
+		if err := db.Create(macro).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run("a new offer replaces the pending one", func(t *testing.T) {
+			createTransfer(t, db, board, carol, time.Now().Add(time.Hour))
+			createTransfer(t, db, board, bob, time.Now().Add(time.Hour))
+			if incoming, aerr := transfers.GetIncoming(carol.ID); aerr != nil || len(incoming) != 0 {
+				t.Fatalf("expected the offer to carol to be replaced, got %+v, %v", incoming, aerr)
+			}
+			if outgoing, aerr := transfers.GetOutgoing(alice.ID); aerr != nil || len(outgoing) != 1 || outgoing[0].ToUserID != bob.ID {
+				t.Fatalf("expected the offer to bob, got %+v, %v", outgoing, aerr)
+			}
+		})
+
+		t.Run("expired offers are ignored", func(t *testing.T) {
+			expired := createTransfer(t, db, lamp, bob, time.Now().Add(-time.Minute))
+			if _, aerr := transfers.GetById(expired.ID); !errors.Is(aerr, TransferNotFoundError) {
+				t.Fatalf("expected the transfer to be expired, got %v", aerr)
+			}
+			if aerr := transfers.Accept(expired, "new secret", nil); !errors.Is(aerr, TransferNotFoundError) {
+				t.Fatalf("expected the expired transfer to be refused, got %v", aerr)
+			}
+			if device, aerr := devices.GetById(lamp.ID); aerr != nil || device.UserID != alice.ID {
+				t.Fatalf("expected the lamp to stay with alice, got %+v, %v", device, aerr)
+			}
+		})
+
+		t.Run("accept", func(t *testing.T) {
+			transfer, aerr := transfers.GetByDeviceId(board.ID)
+			if aerr != nil {
+				t.Fatal(aerr)
+			}
+			if aerr := transfers.Accept(transfer, "new secret", nil); aerr != nil {
+				t.Fatal(aerr)
+			}
+			if aerr := transfers.Accept(transfer, "other secret", nil); !errors.Is(aerr, TransferNotFoundError) {
+				t.Fatalf("expected the transfer to be accepted only once, got %v", aerr)
+			}
+
+			moved, aerr := devices.GetById(board.ID)
+			if aerr != nil {
+				t.Fatal(aerr)
+			}
+			if moved.UserID != bob.ID || moved.Secret != "new secret" {
+				t.Fatalf("the board was not given to bob %+v", moved)
+			}
+			if moved, aerr = devices.GetById(channel.ID); aerr != nil || moved.UserID != bob.ID {
+				t.Fatalf("the channel was not given to bob %+v, %v", moved, aerr)
+			}
+
+			var automations int64
+			if err := db.Model(&entity.Automation{}).Where("id = ?", automation.ID).Count(&automations).Error; err != nil {
+				t.Fatal(err)
+			}
+			var steps []entity.MacroStep
+			if err := db.Where("macro_id = ?", macro.ID).Find(&steps).Error; err != nil {
+				t.Fatal(err)
+			}
+			if automations != 0 || len(steps) != 1 || steps[0].DeviceID != lamp.ID {
+				t.Fatalf("expected the automation and the macro step using the channel to be removed, got %d and %+v", automations, steps)
+			}
+		})
+	})
+}
@@ -33,7 +33,7 @@ func (r *UserRepository) Create(user *entity.User) *errors.Error {
 
 func (r *UserRepository) GetById(id string) (*entity.User, *errors.Error) {
 	var user entity.User
-	err := r.db.Preload("Devices").Where("id = ?", id).First(&user).Error
+	err := r.db.Preload("Devices.Tags").Where("id = ?", id).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New(UserNotFoundError)
@@ -43,6 +43,76 @@ func (r *UserRepository) GetById(id string) (*entity.User, *errors.Error) {
 	return &user, nil
 }
 
+// GetAccountById returns the user without loading its devices
+func (r *UserRepository) GetAccountById(id string) (*entity.User, *errors.Error) {
+	var user entity.User
+	err := r.db.Where("id = ?", id).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New(UserNotFoundError)
+		}
+		return nil, errors.New(err)
+	}
+	return &user, nil
+}
+
+// Search returns a page of the users whose username contains the text, along with the number of users matching
+func (r *UserRepository) Search(text string, limit int, offset int) ([]entity.User, int64, *errors.Error) {
+	query := r.db.Model(&entity.User{})
+	if text != "" {
+		query = query.Where("LOWER(username) LIKE LOWER(?) ESCAPE '!'", "%"+escapeLike(text)+"%")
+	}
+	var total int64
+	err := query.Count(&total).Error
+	if err != nil {
+		return nil, 0, errors.New(err)
+	}
+	var users []entity.User
+	err = query.Preload("Devices").Order("username").Limit(limit).Offset(offset).Find(&users).Error
+	if err != nil {
+		return nil, 0, errors.New(err)
+	}
+	return users, total, nil
+}
+
+// Count returns the number of users and how many of them are disabled
+func (r *UserRepository) Count() (int64, int64, *errors.Error) {
+	var total, disabled int64
+	err := r.db.Model(&entity.User{}).Count(&total).Error
+	if err != nil {
+		return 0, 0, errors.New(err)
+	}
+	err = r.db.Model(&entity.User{}).Where("disabled = ?", true).Count(&disabled).Error
+	if err != nil {
+		return 0, 0, errors.New(err)
+	}
+	return total, disabled, nil
+}
+
+func (r *UserRepository) SetDisabled(user *entity.User, disabled bool) *errors.Error {
+	err := r.db.Model(user).Update("disabled", disabled).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *UserRepository) SetPassword(user *entity.User, password string) *errors.Error {
+	err := r.db.Model(user).Update("password", password).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *UserRepository) SetRole(user *entity.User, role string) *errors.Error {
+	err := r.db.Model(user).Update("role", role).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
 func (r *UserRepository) GetByUsername(username string) (*entity.User, *errors.Error) {
 	var user entity.User
 	err := r.db.Where("username = ?", username).First(&user).Error
@@ -54,3 +124,66 @@ func (r *UserRepository) GetByUsername(username string) (*entity.User, *errors.E
 	}
 	return &user, nil
 }
+
+// Delete removes the user along with everything it owns. The devices are purged rather than trashed, taking their
+// watchdogs and WoL targets with them, since nobody can restore them anymore. The user is not kept either so that its
+// username can be taken again
+func (r *UserRepository) Delete(user *entity.User) *errors.Error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var ids []string
+		err := tx.Unscoped().Model(&entity.Device{}).Where("user_id = ? AND parent_id IS NULL", user.ID).Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := purge(tx, id); err != nil {
+				return err
+			}
+		}
+		err = tx.Where("user_id = ?", user.ID).Delete(&entity.Automation{}).Error
+		if err != nil {
+			return err
+		}
+		macros := tx.Model(&entity.Macro{}).Select("id").Where("user_id = ?", user.ID)
+		err = tx.Where("macro_id IN (?)", macros).Delete(&entity.MacroStep{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("user_id = ?", user.ID).Delete(&entity.Macro{}).Error
+		if err != nil {
+			return err
+		}
+		runs := tx.Model(&entity.MacroRun{}).Select("id").Where("user_id = ?", user.ID)
+		err = tx.Where("macro_run_id IN (?)", runs).Delete(&entity.MacroRunStep{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("user_id = ?", user.ID).Delete(&entity.MacroRun{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("from_user_id = ? OR to_user_id = ?", user.ID, user.ID).Delete(&entity.DeviceTransfer{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(user).Error
+	})
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+// activeUserIds selects the users neither deleted nor disabled, whose automations and watchdogs may run
+func activeUserIds(db *gorm.DB) *gorm.DB {
+	return db.Model(&entity.User{}).Select("id").Where("disabled = ?", false)
+}
+
+// CountCheck fails when the user cannot own one more item given how many items it owns
+type CountCheck func(count int64) *errors.Error
+
+// lockUser makes the transactions changing what the user owns wait for each other so that what they count stays
+// accurate until they end. The row is updated rather than selected for update since SQLite ignores the row locks
+func lockUser(tx *gorm.DB, userId string) error {
+	return tx.Model(&entity.User{}).Where("id = ?", userId).UpdateColumn("id", gorm.Expr("id")).Error
+}
@@ -0,0 +1,167 @@
+package repo
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/infra/entity"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func createUser(t *testing.T, db *gorm.DB, username string) *entity.User {
+	t.Helper()
+	user := &entity.User{
+		ID:       uuid.New().String(),
+		Username: username,
+		Password: "hash",
+		Role:     entity.UserRole,
+	}
+	if aerr := NewUserRepository(db).Create(user); aerr != nil {
+		t.Fatal(aerr)
+	}
+	return user
+}
+
+func TestUserRepository(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		users := NewUserRepository(db)
+		alice := createUser(t, db, "Alice")
+		createUser(t, db, "bob")
+		createUser(t, db, "alicia_100%")
+
+		t.Run("duplicated username", func(t *testing.T) {
+			aerr := users.Create(&entity.User{ID: uuid.New().String(), Username: "Alice"})
+			if !errors.Is(aerr, UsernameAlreadyExistsError) {
+				t.Fatalf("expected the username to be taken, got %v", aerr)
+			}
+		})
+
+		t.Run("search", func(t *testing.T) {
+			found, total, aerr := users.Search("ALI", 1, 0)
+			if aerr != nil {
+				t.Fatal(aerr)
+			}
+			if total != 2 || len(found) != 1 || found[0].Username != "Alice" {
+				t.Fatalf("unexpected search result %d %+v", total, found)
+			}
+			found, total, aerr = users.Search("_100%", 10, 0)
+			if aerr != nil {
+				t.Fatal(aerr)
+			}
+			if total != 1 || found[0].Username != "alicia_100%" {
+				t.Fatalf("the wildcards were not escaped: %d %+v", total, found)
+			}
+		})
+
+		t.Run("update", func(t *testing.T) {
+			if aerr := users.SetDisabled(alice, true); aerr != nil {
+				t.Fatal(aerr)
+			}
+			if aerr := users.SetRole(alice, entity.AdminRole); aerr != nil {
+				t.Fatal(aerr)
+			}
+			total, disabled, aerr := users.Count()
+			if aerr != nil {
+				t.Fatal(aerr)
+			}
+			if total != 3 || disabled != 1 {
+				t.Fatalf("expected 3 users with 1 disabled, got %d and %d", total, disabled)
+			}
+			user, aerr := users.GetByUsername("Alice")
+			if aerr != nil {
+				t.Fatal(aerr)
+			}
+			if !user.Disabled || user.Role != entity.AdminRole {
+				t.Fatalf("the user was not updated %+v", user)
+			}
+		})
+
+		t.Run("disabled users do not trigger anything", func(t *testing.T) {
+			device := createDevice(t, db, alice, "nas")
+			automation := &entity.Automation{ID: uuid.New().String(), UserID: alice.ID, Enabled: true, TriggerType: entity.TimeWindowTrigger, TriggerDeviceID: device.ID}
+			if err := db.Create(automation).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Create(&entity.Watchdog{ID: uuid.New().String(), DeviceID: device.ID, Enabled: true}).Error; err != nil {
+				t.Fatal(err)
+			}
+			automations := NewAutomationRepository(db)
+			for _, disabled := range []bool{false, true} {
+				if aerr := users.SetDisabled(alice, disabled); aerr != nil {
+					t.Fatal(aerr)
+				}
+				byTrigger, aerr := automations.GetEnabledByTrigger(entity.TimeWindowTrigger)
+				if aerr != nil {
+					t.Fatal(aerr)
+				}
+				byDevice, aerr := automations.GetEnabledByTriggerDevice(device.ID)
+				if aerr != nil {
+					t.Fatal(aerr)
+				}
+				watchdogs, aerr := NewWatchdogRepository(db).GetEnabled()
+				if aerr != nil {
+					t.Fatal(aerr)
+				}
+				expected := 1
+				if disabled {
+					expected = 0
+				}
+				if len(byTrigger) != expected || len(byDevice) != expected || len(watchdogs) != expected {
+					t.Fatalf("disabled=%v: expected %d automation and watchdog, got %d, %d and %d", disabled, expected, len(byTrigger), len(byDevice), len(watchdogs))
+				}
+			}
+		})
+
+		t.Run("delete", func(t *testing.T) {
+			device := createDevice(t, db, alice, "desktop")
+			channel := createChannel(t, db, device, 1)
+			if err := db.Create(&entity.WolTarget{ID: uuid.New().String(), DeviceID: device.ID}).Error; err != nil {
+				t.Fatal(err)
+			}
+			macro := &entity.Macro{ID: uuid.New().String(), UserID: alice.ID, Steps: []entity.MacroStep{
+				{Position: 0, Type: entity.DelayStep},
+			}}
+			if err := db.Create(macro).Error; err != nil {
+				t.Fatal(err)
+			}
+			automation := &entity.Automation{ID: uuid.New().String(), UserID: alice.ID, TriggerType: entity.TimeWindowTrigger, ActionType: entity.WebhookAction}
+			if err := db.Create(automation).Error; err != nil {
+				t.Fatal(err)
+			}
+			run := &entity.MacroRun{ID: uuid.New().String(), UserID: alice.ID, MacroID: macro.ID, Steps: []entity.MacroRunStep{
+				{Position: 0, Type: entity.DelayStep},
+			}}
+			if aerr := NewMacroRunRepository(db).Create(run); aerr != nil {
+				t.Fatal(aerr)
+			}
+			if aerr := users.Delete(alice); aerr != nil {
+				t.Fatal(aerr)
+			}
+			if _, aerr := users.GetById(alice.ID); !errors.Is(aerr, UserNotFoundError) {
+				t.Fatalf("expected the user to be deleted, got %v", aerr)
+			}
+			if _, aerr := NewDeviceRepository(db).GetById(device.ID); !errors.Is(aerr, DeviceNotFoundError) {
+				t.Fatalf("expected the device to be deleted, got %v", aerr)
+			}
+			for _, model := range []interface{}{&entity.Automation{}, &entity.Macro{}, &entity.MacroStep{}, &entity.MacroRun{}, &entity.MacroRunStep{}, &entity.Watchdog{}, &entity.WolTarget{}} {
+				var count int64
+				if err := db.Model(model).Count(&count).Error; err != nil {
+					t.Fatal(err)
+				}
+				if count != 0 {
+					t.Fatalf("expected the %T of the user to be deleted, %d are left", model, count)
+				}
+			}
+			var devices int64
+			if err := db.Unscoped().Model(&entity.Device{}).Where("id IN ?", []string{device.ID, channel.ID}).Count(&devices).Error; err != nil {
+				t.Fatal(err)
+			}
+			if devices != 0 {
+				t.Fatalf("expected the devices to be purged rather than trashed, %d are left", devices)
+			}
+			if aerr := users.Create(&entity.User{ID: uuid.New().String(), Username: "Alice"}); aerr != nil {
+				t.Fatalf("expected the username of the deleted user to be free, got %v", aerr)
+			}
+		})
+	})
+}
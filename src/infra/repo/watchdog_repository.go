@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
+	"gorm.io/gorm"
+	"time"
+)
+
+var WatchdogNotFoundError = exceptions.NewObjectNotFound("no watchdog is configured for this device")
+
+type WatchdogRepository struct {
+	db *gorm.DB
+}
+
+func NewWatchdogRepository(db *gorm.DB) *WatchdogRepository {
+	return &WatchdogRepository{
+		db: db,
+	}
+}
+
+// Save replaces the watchdog of a device along with all of its escalation steps
+func (r *WatchdogRepository) Save(watchdog *entity.Watchdog) *errors.Error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("watchdog_id = ?", watchdog.ID).Delete(&entity.WatchdogStep{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Save(watchdog).Error
+	})
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *WatchdogRepository) Delete(watchdog *entity.Watchdog) *errors.Error {
+	err := r.db.Select("Steps").Delete(watchdog).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *WatchdogRepository) GetByDeviceId(deviceId string) (*entity.Watchdog, *errors.Error) {
+	var watchdog entity.Watchdog
+	err := r.db.Preload("Steps", orderStepsByPosition).Where("device_id = ?", deviceId).First(&watchdog).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New(WatchdogNotFoundError)
+		}
+		return nil, errors.New(err)
+	}
+	return &watchdog, nil
+}
+
+// GetEnabled returns the enabled watchdogs of the devices owned by the users neither deleted nor disabled
+func (r *WatchdogRepository) GetEnabled() ([]entity.Watchdog, *errors.Error) {
+	var watchdogs []entity.Watchdog
+	devices := r.db.Model(&entity.Device{}).Select("id").Where("user_id IN (?)", activeUserIds(r.db))
+	err := r.db.Preload("Steps", orderStepsByPosition).Where("enabled = ? AND device_id IN (?)", true, devices).Find(&watchdogs).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return watchdogs, nil
+}
+
+func (r *WatchdogRepository) UpdateHeartbeat(deviceId string, heartbeat time.Time) *errors.Error {
+	result := r.db.Model(&entity.Watchdog{}).Where("device_id = ?", deviceId).Update("last_heartbeat", heartbeat)
+	if result.Error != nil {
+		return errors.New(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New(WatchdogNotFoundError)
+	}
+	return nil
+}
+
+func orderStepsByPosition(db *gorm.DB) *gorm.DB {
+	return db.Order("position")
+}
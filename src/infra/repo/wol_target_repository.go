@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
+	"gorm.io/gorm"
+)
+
+var WolTargetNotFoundError = exceptions.NewObjectNotFound("wake-on-lan target not found")
+
+type WolTargetRepository struct {
+	db *gorm.DB
+}
+
+func NewWolTargetRepository(db *gorm.DB) *WolTargetRepository {
+	return &WolTargetRepository{
+		db: db,
+	}
+}
+
+func (r *WolTargetRepository) Create(target *entity.WolTarget) *errors.Error {
+	err := r.db.Create(target).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *WolTargetRepository) Delete(target *entity.WolTarget) *errors.Error {
+	err := r.db.Delete(target).Error
+	if err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+func (r *WolTargetRepository) GetByIdAndDeviceId(id string, deviceId string) (*entity.WolTarget, *errors.Error) {
+	var target entity.WolTarget
+	err := r.db.Where("id = ? AND device_id = ?", id, deviceId).First(&target).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New(WolTargetNotFoundError)
+		}
+		return nil, errors.New(err)
+	}
+	return &target, nil
+}
+
+func (r *WolTargetRepository) GetByDeviceId(deviceId string) ([]entity.WolTarget, *errors.Error) {
+	var targets []entity.WolTarget
+	err := r.db.Where("device_id = ?", deviceId).Order("created_at").Find(&targets).Error
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return targets, nil
+}
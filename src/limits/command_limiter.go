@@ -0,0 +1,72 @@
+package limits
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/exceptions"
+	"math"
+	"sync"
+	"time"
+)
+
+const pruneMinPeriod = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// CommandLimiter is a token bucket per device allowing bursts up to the rate per minute. The buckets are kept in
+// memory, each instance of a cluster enforces the rate on its own
+type CommandLimiter struct {
+	perMinute int
+	buckets   map[string]*bucket
+	lastPrune time.Time
+	mu        sync.Mutex
+}
+
+func NewCommandLimiter(perMinute int) *CommandLimiter {
+	return &CommandLimiter{
+		perMinute: perMinute,
+		buckets:   make(map[string]*bucket),
+		lastPrune: time.Now(),
+	}
+}
+
+func (l *CommandLimiter) Allow(deviceId string) *errors.Error {
+	if l.perMinute <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.prune(now)
+
+	capacity := float64(l.perMinute)
+	rate := capacity / time.Minute.Seconds()
+	b, ok := l.buckets[deviceId]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[deviceId] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		retryAfter := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return errors.New(exceptions.NewLimitExceeded("too many commands have been sent to this device", retryAfter))
+	}
+	b.tokens--
+	return nil
+}
+
+// prune forgets the buckets that have refilled, they would be created full anyway
+func (l *CommandLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneMinPeriod {
+		return
+	}
+	l.lastPrune = now
+	for deviceId, b := range l.buckets {
+		if now.Sub(b.last) >= time.Minute {
+			delete(l.buckets, deviceId)
+		}
+	}
+}
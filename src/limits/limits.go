@@ -0,0 +1,56 @@
+package limits
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/pc-power-api/src/exceptions"
+	"sync"
+)
+
+// Limits are the quotas applied to every user, a zero value means unlimited
+type Limits struct {
+	MaxDevices        int `yaml:"max_devices"`
+	CommandsPerMinute int `yaml:"commands_per_minute"`
+	MaxWebhooks       int `yaml:"max_webhooks"`
+	MaxSchedules      int `yaml:"max_schedules"`
+}
+
+var DefaultLimits = Limits{
+	MaxDevices:        50,
+	CommandsPerMinute: 30,
+	MaxWebhooks:       25,
+	MaxSchedules:      25,
+}
+
+var current = DefaultLimits
+var commands = NewCommandLimiter(DefaultLimits.CommandsPerMinute)
+var mu = sync.Mutex{}
+
+// Configure replaces the limits in use, the command rates tracked so far are reset
+func Configure(limits Limits) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = limits
+	commands = NewCommandLimiter(limits.CommandsPerMinute)
+}
+
+func Get() Limits {
+	mu.Lock()
+	defer mu.Unlock()
+	return current
+}
+
+func AllowCommand(deviceId string) *errors.Error {
+	mu.Lock()
+	limiter := commands
+	mu.Unlock()
+	return limiter.Allow(deviceId)
+}
+
+// CheckCount fails when adding one more item to the used ones would go over the limit
+func CheckCount(name string, used int64, limit int) *errors.Error {
+	if limit > 0 && used >= int64(limit) {
+		return errors.New(exceptions.NewLimitExceeded(fmt.Sprintf("the limit of %d %s has been reached", limit, name), 0))
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package macro
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/api"
+	"github.com/pc-power-api/src/controller/gateway"
+	"github.com/pc-power-api/src/exceptions"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/infra/repo"
+	"github.com/pc-power-api/src/limits"
+	"log"
+	"sync"
+	"time"
+)
+
+const WaitPollPeriod = time.Second
+const RunRetention = 24 * time.Hour
+
+var WaitStateTimeoutError = exceptions.NewDeviceUnreachable("the device did not reach the expected state in time")
+var RunInterruptedError = errors.Errorf("the server shut down before the macro finished")
+
+type Run struct {
+	UserID string
+	mu     sync.Mutex
+	info   api.MacroRunInfo
+}
+
+func (r *Run) Snapshot() api.MacroRunInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshot := r.info
+	snapshot.Steps = append([]api.MacroStepRunInfo(nil), r.info.Steps...)
+	return snapshot
+}
+
+// record copies the progress of the run to be saved
+func (r *Run) record() *entity.MacroRun {
+	snapshot := r.Snapshot()
+	run := &entity.MacroRun{
+		ID:         snapshot.ID,
+		UserID:     r.UserID,
+		MacroID:    snapshot.MacroID,
+		Status:     snapshot.Status,
+		StartedAt:  snapshot.StartedAt,
+		FinishedAt: snapshot.FinishedAt,
+		Steps:      make([]entity.MacroRunStep, 0, len(snapshot.Steps)),
+	}
+	for _, step := range snapshot.Steps {
+		run.Steps = append(run.Steps, entity.MacroRunStep{
+			MacroRunID: snapshot.ID,
+			Position:   step.Position,
+			Type:       step.Type,
+			DeviceID:   step.DeviceID,
+			Status:     step.Status,
+			StartedAt:  step.StartedAt,
+			FinishedAt: step.FinishedAt,
+			Error:      step.Error,
+		})
+	}
+	return run
+}
+
+func toRun(record *entity.MacroRun) *Run {
+	steps := make([]api.MacroStepRunInfo, 0, len(record.Steps))
+	for _, step := range record.Steps {
+		steps = append(steps, api.MacroStepRunInfo{
+			Position:   step.Position,
+			Type:       step.Type,
+			DeviceID:   step.DeviceID,
+			Status:     step.Status,
+			StartedAt:  step.StartedAt,
+			FinishedAt: step.FinishedAt,
+			Error:      step.Error,
+		})
+	}
+	return &Run{
+		UserID: record.UserID,
+		info: api.MacroRunInfo{
+			ID:         record.ID,
+			MacroID:    record.MacroID,
+			Status:     record.Status,
+			StartedAt:  record.StartedAt,
+			FinishedAt: record.FinishedAt,
+			Steps:      steps,
+		},
+	}
+}
+
+func (r *Run) startStep(position int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.info.Steps[position].Status = api.MacroRunning
+	r.info.Steps[position].StartedAt = &now
+}
+
+func (r *Run) finishStep(position int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.info.Steps[position].FinishedAt = &now
+	if err != nil {
+		r.info.Steps[position].Status = api.MacroFailed
+		r.info.Steps[position].Error = err.Error()
+		for i := position + 1; i < len(r.info.Steps); i++ {
+			r.info.Steps[i].Status = api.MacroStepSkipped
+		}
+		r.info.Status = api.MacroFailed
+		r.info.FinishedAt = &now
+		return
+	}
+	r.info.Steps[position].Status = api.MacroSucceeded
+	if position == len(r.info.Steps)-1 {
+		r.info.Status = api.MacroSucceeded
+		r.info.FinishedAt = &now
+	}
+}
+
+// Runner executes the macros in the background and saves the progress of the runs after every step, the runs are
+// reported by any instance. A run left unfinished by an instance that crashed stays running until it is pruned
+type Runner struct {
+	auditRepo *repo.AuditRepository
+	runRepo   *repo.MacroRunRepository
+	stop      chan struct{}
+	running   sync.WaitGroup
+}
+
+func NewRunner(auditRepo *repo.AuditRepository, runRepo *repo.MacroRunRepository) *Runner {
+	return &Runner{
+		auditRepo: auditRepo,
+		runRepo:   runRepo,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Stop interrupts the runs waiting for a device or a delay and waits for every run to end, no run may be started
+// once it has been called
+func (r *Runner) Stop() {
+	close(r.stop)
+	r.running.Wait()
+}
+
+func (r *Runner) Start(macro *entity.Macro) (*Run, *errors.Error) {
+	steps := make([]api.MacroStepRunInfo, 0, len(macro.Steps))
+	for i, step := range macro.Steps {
+		steps = append(steps, api.MacroStepRunInfo{
+			Position: i,
+			Type:     step.Type,
+			DeviceID: step.DeviceID,
+			Status:   api.MacroStepPending,
+		})
+	}
+	run := &Run{
+		UserID: macro.UserID,
+		info: api.MacroRunInfo{
+			ID:        uuid.New().String(),
+			MacroID:   macro.ID,
+			Status:    api.MacroRunning,
+			StartedAt: time.Now(),
+			Steps:     steps,
+		},
+	}
+
+	if aerr := r.runRepo.DeleteFinishedBefore(time.Now().Add(-RunRetention)); aerr != nil {
+		log.Println(aerr.ErrorStack())
+	}
+	if aerr := r.runRepo.Create(run.record()); aerr != nil {
+		return nil, aerr
+	}
+
+	r.running.Add(1)
+	go r.execute(run, macro)
+	return run, nil
+}
+
+func (r *Runner) GetRun(id string) (*Run, *errors.Error) {
+	record, aerr := r.runRepo.GetById(id)
+	if aerr != nil {
+		return nil, aerr
+	}
+	return toRun(record), nil
+}
+
+func (r *Runner) execute(run *Run, macro *entity.Macro) {
+	defer r.running.Done()
+	for i, step := range macro.Steps {
+		run.startStep(i)
+		r.save(run)
+		err := r.executeStep(macro, &step)
+		run.finishStep(i, err)
+		r.save(run)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *Runner) save(run *Run) {
+	if aerr := r.runRepo.Save(run.record()); aerr != nil {
+		log.Println(aerr.ErrorStack())
+	}
+}
+
+func (r *Runner) executeStep(macro *entity.Macro, step *entity.MacroStep) error {
+	select {
+	case <-r.stop:
+		return RunInterruptedError
+	default:
+	}
+	switch step.Type {
+	case entity.CommandStep:
+		// The macros are started by their owner, their commands count towards the same rate as the ones sent directly
+		err := limits.AllowCommand(step.DeviceID)
+		if err == nil {
+			err = gateway.SendCommand(step.DeviceID, step.Command)
+		}
+		r.audit(macro, step, err)
+		if err != nil {
+			return err
+		}
+	case entity.WaitStateStep:
+		return r.waitForState(step.DeviceID, step.Status, time.Duration(step.Timeout)*time.Second)
+	case entity.DelayStep:
+		timer := time.NewTimer(time.Duration(step.Duration) * time.Second)
+		defer timer.Stop()
+		select {
+		case <-r.stop:
+			return RunInterruptedError
+		case <-timer.C:
+		}
+	}
+	return nil
+}
+
+func (r *Runner) waitForState(deviceId string, status int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(WaitPollPeriod)
+	defer ticker.Stop()
+	for {
+		if state := gateway.GetDeviceState(deviceId); state.Online && state.Status == status {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return WaitStateTimeoutError
+		}
+		select {
+		case <-r.stop:
+			return RunInterruptedError
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Runner) audit(macro *entity.Macro, step *entity.MacroStep, err *errors.Error) {
+	details := macro.Name + ": sent " + step.Command
+	if err != nil {
+		details += ", failed: " + err.Error()
+	}
+	aerr := r.auditRepo.Create(&entity.AuditEntry{
+		ID:       uuid.New().String(),
+		UserID:   macro.UserID,
+		DeviceID: step.DeviceID,
+		Actor:    entity.MacroActor,
+		Action:   step.Command,
+		Details:  details,
+	})
+	if aerr != nil {
+		log.Println(aerr.ErrorStack())
+	}
+}
@@ -0,0 +1,5 @@
+package metrics
+
+// Namespace prefixes the name of every metric exported by the API, the collectors are declared by the packages
+// they observe and registered in the default prometheus registry
+const Namespace = "pcpower"
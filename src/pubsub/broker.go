@@ -0,0 +1,196 @@
+package pubsub
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const HistorySize = 1024
+
+// Broker delivers the published events to the subscriptions of their topic. Each subscription has its own queue so a
+// slow subscriber never blocks the publisher nor the other subscribers. The sequence numbers only make sense to the
+// broker that gave them, the cursors handed to the clients carry the broker epoch for that reason
+type Broker struct {
+	mu       sync.Mutex
+	epoch    string
+	topics   map[string]map[*Subscription]struct{}
+	wildcard map[*Subscription]struct{}
+	// subscriptions holds every open subscription, including the ones without any topic at the moment
+	subscriptions map[*Subscription]struct{}
+	sequence      uint64
+	history       []Event
+	head          int
+	count         int
+}
+
+func NewBroker(historySize int) *Broker {
+	return &Broker{
+		mu:            sync.Mutex{},
+		epoch:         uuid.New().String(),
+		topics:        make(map[string]map[*Subscription]struct{}),
+		wildcard:      make(map[*Subscription]struct{}),
+		subscriptions: make(map[*Subscription]struct{}),
+		history:       make([]Event, historySize),
+	}
+}
+
+// Subscribe starts delivering the events of the given topics to the subscriber, every topic is delivered when
+// options.AllTopics is set
+func (b *Broker) Subscribe(subscriber Subscriber, options SubscriptionOptions, topics ...string) *Subscription {
+	if options.QueueSize <= 0 {
+		options.QueueSize = DefaultQueueSize
+	}
+	subscription := &Subscription{
+		broker:     b,
+		subscriber: subscriber,
+		options:    options,
+		queue:      make(chan Event, options.QueueSize),
+		topics:     make(map[string]struct{}),
+		done:       make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	b.subscriptions[subscription] = struct{}{}
+	if options.AllTopics {
+		b.wildcard[subscription] = struct{}{}
+	}
+	b.addTopics(subscription, topics)
+	b.mu.Unlock()
+
+	go subscription.run()
+	return subscription
+}
+
+func (b *Broker) Publish(topic string, data interface{}) {
+	b.publish(topic, data, false)
+}
+
+// PublishRemote delivers an event that has been published by another instance of the API
+func (b *Broker) PublishRemote(topic string, data interface{}) {
+	b.publish(topic, data, true)
+}
+
+func (b *Broker) publish(topic string, data interface{}, remote bool) {
+	b.mu.Lock()
+	b.sequence++
+	event := Event{
+		Seq:         b.sequence,
+		Topic:       topic,
+		Data:        data,
+		Remote:      remote,
+		PublishedAt: time.Now(),
+	}
+	b.remember(event)
+
+	// The events are queued while holding the lock so that every subscription receives them in sequence order
+	var overflowed []*Subscription
+	for subscription := range b.topics[topic] {
+		if !subscription.offer(event) {
+			overflowed = append(overflowed, subscription)
+		}
+	}
+	for subscription := range b.wildcard {
+		if !subscription.offer(event) {
+			overflowed = append(overflowed, subscription)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, subscription := range overflowed {
+		subscription.overflow(event)
+	}
+}
+
+func (b *Broker) LastSequence() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sequence
+}
+
+// Since returns the events published after the given sequence number, ok is false when some of them are no longer
+// kept in the history
+func (b *Broker) Since(seq uint64) (events []Event, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if seq > b.sequence {
+		return nil, false
+	}
+	missed := b.sequence - seq
+	if missed > uint64(b.count) {
+		return nil, false
+	}
+	events = make([]Event, 0, missed)
+	for i := b.count - int(missed); i < b.count; i++ {
+		events = append(events, b.history[(b.head+i)%len(b.history)])
+	}
+	return events, true
+}
+
+// Cursor returns the position of the given sequence number to hand to a client resuming later
+func (b *Broker) Cursor(seq uint64) string {
+	return fmt.Sprintf("%s:%d", b.epoch, seq)
+}
+
+// SinceCursor returns the events published after the given cursor and the sequence number it points to, ok is false
+// when the cursor is invalid, comes from another broker, another instance or before a restart, or when some events are
+// no longer kept in the history
+func (b *Broker) SinceCursor(cursor string) (events []Event, seq uint64, ok bool) {
+	epoch, position, found := strings.Cut(cursor, ":")
+	if !found || epoch != b.epoch {
+		return nil, 0, false
+	}
+	seq, err := strconv.ParseUint(position, 10, 64)
+	if err != nil {
+		return nil, 0, false
+	}
+	events, ok = b.Since(seq)
+	return events, seq, ok
+}
+
+// SubscriptionCount returns the number of active subscriptions
+func (b *Broker) SubscriptionCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscriptions)
+}
+
+func (b *Broker) remember(event Event) {
+	if len(b.history) == 0 {
+		return
+	}
+	if b.count < len(b.history) {
+		b.history[(b.head+b.count)%len(b.history)] = event
+		b.count++
+		return
+	}
+	b.history[b.head] = event
+	b.head = (b.head + 1) % len(b.history)
+}
+
+func (b *Broker) addTopics(subscription *Subscription, topics []string) {
+	for _, topic := range topics {
+		subscribers, ok := b.topics[topic]
+		if !ok {
+			subscribers = make(map[*Subscription]struct{})
+			b.topics[topic] = subscribers
+		}
+		subscribers[subscription] = struct{}{}
+		subscription.topics[topic] = struct{}{}
+	}
+}
+
+func (b *Broker) removeTopics(subscription *Subscription, topics []string) {
+	for _, topic := range topics {
+		if subscribers, ok := b.topics[topic]; ok {
+			delete(subscribers, subscription)
+			if len(subscribers) == 0 {
+				delete(b.topics, topic)
+			}
+		}
+		delete(subscription.topics, topic)
+	}
+}
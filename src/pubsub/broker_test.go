@@ -0,0 +1,270 @@
+package pubsub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testTimeout = 2 * time.Second
+
+// recorder keeps the events it is notified of, block holds the deliveries until it is closed
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+	block  chan struct{}
+}
+
+func (r *recorder) Notify(event Event) {
+	if r.block != nil {
+		<-r.block
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) waitFor(t *testing.T, count int) []Event {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		if len(r.events) >= count {
+			events := append([]Event(nil), r.events...)
+			r.mu.Unlock()
+			return events
+		}
+		r.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t.Fatalf("received %d events, expected %d", len(r.events), count)
+	return nil
+}
+
+func TestPublishDeliversTheTopicsInOrder(t *testing.T) {
+	broker := NewBroker(16)
+	subscriber := &recorder{}
+	subscription := broker.Subscribe(subscriber, SubscriptionOptions{}, "a")
+	defer subscription.Close()
+
+	broker.Publish("a", 1)
+	broker.Publish("b", 2)
+	broker.Publish("a", 3)
+
+	events := subscriber.waitFor(t, 2)
+	if len(events) != 2 || events[0].Data != 1 || events[1].Data != 3 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if events[0].Seq >= events[1].Seq {
+		t.Fatalf("the sequence numbers are not increasing: %d then %d", events[0].Seq, events[1].Seq)
+	}
+}
+
+func TestAllTopicsAndTopicChanges(t *testing.T) {
+	broker := NewBroker(16)
+	wildcard := &recorder{}
+	broker.Subscribe(wildcard, SubscriptionOptions{AllTopics: true})
+	subscriber := &recorder{}
+	subscription := broker.Subscribe(subscriber, SubscriptionOptions{})
+
+	subscription.AddTopics("a")
+	broker.Publish("a", 1)
+	subscription.RemoveTopics("a")
+	broker.Publish("a", 2)
+
+	wildcard.waitFor(t, 2)
+	time.Sleep(10 * time.Millisecond)
+	events := subscriber.waitFor(t, 1)
+	if len(events) != 1 || events[0].Data != 1 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if count := broker.SubscriptionCount(); count != 2 {
+		t.Fatalf("expected 2 subscriptions, got %d", count)
+	}
+}
+
+func TestDropPolicyKeepsTheSubscription(t *testing.T) {
+	broker := NewBroker(16)
+	subscriber := &recorder{block: make(chan struct{})}
+	subscription := broker.Subscribe(subscriber, SubscriptionOptions{QueueSize: 1, Policy: DropPolicy}, "a")
+	defer subscription.Close()
+
+	// The first event is held by the subscriber, the second one fills the queue and the others are dropped
+	for i := 0; i < 5; i++ {
+		broker.Publish("a", i)
+		if i == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	close(subscriber.block)
+
+	subscriber.waitFor(t, 2)
+	if dropped := subscription.Dropped(); dropped != 3 {
+		t.Fatalf("expected 3 dropped events, got %d", dropped)
+	}
+	broker.Publish("a", 5)
+	subscriber.waitFor(t, 3)
+}
+
+func TestDisconnectPolicyClosesTheSubscription(t *testing.T) {
+	broker := NewBroker(16)
+	subscriber := &recorder{block: make(chan struct{})}
+	defer close(subscriber.block)
+	disconnected := make(chan struct{})
+	broker.Subscribe(subscriber, SubscriptionOptions{
+		QueueSize:    1,
+		Policy:       DisconnectPolicy,
+		OnDisconnect: func() { close(disconnected) },
+	}, "a")
+
+	for i := 0; i < 3; i++ {
+		broker.Publish("a", i)
+		if i == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	select {
+	case <-disconnected:
+	case <-time.After(testTimeout):
+		t.Fatal("the subscription was not disconnected")
+	}
+	if count := broker.SubscriptionCount(); count != 0 {
+		t.Fatalf("expected no subscription left, got %d", count)
+	}
+}
+
+func TestSinceReplaysTheHistory(t *testing.T) {
+	broker := NewBroker(3)
+	for i := 0; i < 5; i++ {
+		broker.Publish("a", i)
+	}
+
+	events, ok := broker.Since(3)
+	if !ok || len(events) != 2 || events[0].Seq != 4 || events[1].Seq != 5 {
+		t.Fatalf("unexpected replay %+v, %v", events, ok)
+	}
+	if _, ok := broker.Since(1); ok {
+		t.Fatal("the events no longer kept in the history were replayed")
+	}
+	if _, ok := broker.Since(6); ok {
+		t.Fatal("a sequence number from the future was accepted")
+	}
+	if events, ok := broker.Since(5); !ok || len(events) != 0 {
+		t.Fatalf("unexpected replay %+v, %v", events, ok)
+	}
+}
+
+func TestSinceCursorRefusesOtherBrokers(t *testing.T) {
+	broker := NewBroker(8)
+	other := NewBroker(8)
+	for i := 0; i < 5; i++ {
+		broker.Publish("a", i)
+		other.Publish("a", i)
+	}
+
+	events, seq, ok := broker.SinceCursor(broker.Cursor(3))
+	if !ok || seq != 3 || len(events) != 2 || events[0].Seq != 4 {
+		t.Fatalf("unexpected replay %+v, %d, %v", events, seq, ok)
+	}
+	if _, _, ok := broker.SinceCursor(other.Cursor(3)); ok {
+		t.Fatal("the cursor of another broker was accepted")
+	}
+	for _, cursor := range []string{"3", "", broker.Cursor(3) + "x", strings.Replace(broker.Cursor(3), ":", "", 1)} {
+		if _, _, ok := broker.SinceCursor(cursor); ok {
+			t.Fatalf("the invalid cursor %q was accepted", cursor)
+		}
+	}
+}
+
+// counter signals the benchmark once every subscriber received the event being published
+type counter struct {
+	delivered *sync.WaitGroup
+	received  atomic.Uint64
+}
+
+func (c *counter) Notify(event Event) {
+	c.received.Add(1)
+	if c.delivered != nil {
+		c.delivered.Done()
+	}
+}
+
+// BenchmarkPublish measures the fan-out of an event to thousands of users. The delivered benchmarks wait for every
+// subscriber to be notified, the burst ones only measure the publisher and report the subscriptions that overflowed
+func BenchmarkPublish(b *testing.B) {
+	policies := map[string]OverflowPolicy{"drop": DropPolicy, "disconnect": DisconnectPolicy}
+	for _, subscribers := range []int{1000, 10000} {
+		for name, policy := range policies {
+			b.Run(fmt.Sprintf("delivered/%s/%d", name, subscribers), func(b *testing.B) {
+				benchmarkDelivered(b, policy, subscribers)
+			})
+			b.Run(fmt.Sprintf("burst/%s/%d", name, subscribers), func(b *testing.B) {
+				benchmarkBurst(b, policy, subscribers)
+			})
+		}
+	}
+}
+
+// benchmarkDelivered subscribes every user to the published topic and to a topic of their own, like the devices
+// shared by the users of a household
+func benchmarkDelivered(b *testing.B, policy OverflowPolicy, subscribers int) {
+	broker := NewBroker(HistorySize)
+	delivered := &sync.WaitGroup{}
+	subscriptions := subscribe(broker, policy, subscribers, func() Subscriber {
+		return &counter{delivered: delivered}
+	})
+	defer closeAll(subscriptions)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		delivered.Add(subscribers)
+		broker.Publish("shared", i)
+		delivered.Wait()
+	}
+}
+
+func benchmarkBurst(b *testing.B, policy OverflowPolicy, subscribers int) {
+	broker := NewBroker(HistorySize)
+	subscriptions := subscribe(broker, policy, subscribers, func() Subscriber {
+		return &counter{}
+	})
+	defer closeAll(subscriptions)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		broker.Publish("shared", i)
+	}
+	b.StopTimer()
+
+	var overflowed uint64
+	for _, subscription := range subscriptions {
+		overflowed += subscription.Dropped()
+	}
+	if policy == DisconnectPolicy {
+		overflowed = uint64(subscribers - broker.SubscriptionCount())
+	}
+	b.ReportMetric(float64(overflowed), "overflowed")
+}
+
+func subscribe(broker *Broker, policy OverflowPolicy, count int, newSubscriber func() Subscriber) []*Subscription {
+	subscriptions := make([]*Subscription, 0, count)
+	for i := 0; i < count; i++ {
+		subscriptions = append(subscriptions, broker.Subscribe(newSubscriber(), SubscriptionOptions{
+			Policy: policy,
+		}, "shared", "user-"+strconv.Itoa(i)))
+	}
+	return subscriptions
+}
+
+func closeAll(subscriptions []*Subscription) {
+	for _, subscription := range subscriptions {
+		subscription.Close()
+	}
+}
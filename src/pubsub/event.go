@@ -0,0 +1,12 @@
+package pubsub
+
+import "time"
+
+type Event struct {
+	Seq   uint64
+	Topic string
+	Data  interface{}
+	// Remote is set on the events received from another instance of the API
+	Remote      bool
+	PublishedAt time.Time
+}
@@ -0,0 +1,15 @@
+package pubsub
+
+import (
+	"github.com/pc-power-api/src/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var fanOutLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "pubsub",
+	Name:      "fan_out_latency_seconds",
+	Help:      "Time between the publication of an event and its delivery to a subscriber.",
+	Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5},
+})
@@ -0,0 +1,36 @@
+package pubsub
+
+// Default is the broker shared by the gateways and the background jobs
+var Default = NewBroker(HistorySize)
+
+func Subscribe(subscriber Subscriber, options SubscriptionOptions, topics ...string) *Subscription {
+	return Default.Subscribe(subscriber, options, topics...)
+}
+
+func Publish(topic string, data interface{}) {
+	Default.Publish(topic, data)
+}
+
+func PublishRemote(topic string, data interface{}) {
+	Default.PublishRemote(topic, data)
+}
+
+func LastSequence() uint64 {
+	return Default.LastSequence()
+}
+
+// Since returns the events published after the given sequence number, ok is false when some of them are no longer
+// kept in the history
+func Since(seq uint64) (events []Event, ok bool) {
+	return Default.Since(seq)
+}
+
+func Cursor(seq uint64) string {
+	return Default.Cursor(seq)
+}
+
+// SinceCursor returns the events published after the given cursor and the sequence number it points to, ok is false
+// when the events cannot be replayed from this instance
+func SinceCursor(cursor string) (events []Event, seq uint64, ok bool) {
+	return Default.SinceCursor(cursor)
+}
@@ -1,5 +1,5 @@
 package pubsub
 
 type Subscriber interface {
-	Notify(topic string, data interface{})
+	Notify(event Event)
 }
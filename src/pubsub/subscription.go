@@ -0,0 +1,125 @@
+package pubsub
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const DefaultQueueSize = 256
+
+type OverflowPolicy int
+
+const (
+	// DropPolicy discards the events that do not fit in the queue of the subscription
+	DropPolicy OverflowPolicy = iota
+	// DisconnectPolicy closes the subscription as soon as an event does not fit in its queue
+	DisconnectPolicy
+)
+
+type SubscriptionOptions struct {
+	QueueSize int
+	Policy    OverflowPolicy
+	AllTopics bool
+	// OnDisconnect is called once the subscription has been closed by the DisconnectPolicy
+	OnDisconnect func()
+}
+
+// Subscription delivers the events queued by the broker to its subscriber on its own goroutine
+type Subscription struct {
+	broker         *Broker
+	subscriber     Subscriber
+	options        SubscriptionOptions
+	queue          chan Event
+	topics         map[string]struct{}
+	done           chan struct{}
+	closeOnce      sync.Once
+	disconnectOnce sync.Once
+	dropped        atomic.Uint64
+}
+
+func (s *Subscription) AddTopics(topics ...string) {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	if s.closed() {
+		return
+	}
+	s.broker.addTopics(s, topics)
+}
+
+func (s *Subscription) RemoveTopics(topics ...string) {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.removeTopics(s, topics)
+}
+
+// Close stops the delivery, the events still queued are discarded
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		s.broker.mu.Lock()
+		delete(s.broker.wildcard, s)
+		delete(s.broker.subscriptions, s)
+		topics := make([]string, 0, len(s.topics))
+		for topic := range s.topics {
+			topics = append(topics, topic)
+		}
+		s.broker.removeTopics(s, topics)
+		close(s.done)
+		s.broker.mu.Unlock()
+	})
+}
+
+// Dropped returns the number of events discarded by the DropPolicy
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (s *Subscription) offer(event Event) bool {
+	select {
+	case s.queue <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Subscription) overflow(event Event) {
+	if s.options.Policy == DropPolicy {
+		s.dropped.Add(1)
+		log.Printf("subscriber is falling behind, dropped event %d of topic %s", event.Seq, event.Topic)
+		return
+	}
+	s.disconnectOnce.Do(func() {
+		s.Close()
+		if s.options.OnDisconnect != nil {
+			s.options.OnDisconnect()
+		}
+	})
+}
+
+func (s *Subscription) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Subscription) run() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case event := <-s.queue:
+			select {
+			case <-s.done:
+				return
+			default:
+				fanOutLatency.Observe(time.Since(event.PublishedAt).Seconds())
+				s.subscriber.Notify(event)
+			}
+		}
+	}
+}
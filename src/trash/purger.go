@@ -0,0 +1,60 @@
+package trash
+
+import (
+	"github.com/pc-power-api/src/infra/repo"
+	"log"
+	"sync"
+	"time"
+)
+
+const PurgePeriod = time.Hour
+
+// Purger permanently deletes the devices that stayed in the trash longer than the retention period
+type Purger struct {
+	deviceRepo *repo.DeviceRepository
+	retention  time.Duration
+	stop       chan struct{}
+	stopped    sync.WaitGroup
+}
+
+func NewPurger(deviceRepo *repo.DeviceRepository, retention time.Duration) *Purger {
+	return &Purger{
+		deviceRepo: deviceRepo,
+		retention:  retention,
+		stop:       make(chan struct{}),
+	}
+}
+
+func (p *Purger) Start() {
+	p.stopped.Add(1)
+	go func() {
+		defer p.stopped.Done()
+		p.purge(time.Now())
+		ticker := time.NewTicker(PurgePeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case now := <-ticker.C:
+				p.purge(now)
+			}
+		}
+	}()
+}
+
+// Stop waits for the purge in progress to end
+func (p *Purger) Stop() {
+	close(p.stop)
+	p.stopped.Wait()
+}
+
+func (p *Purger) purge(now time.Time) {
+	purged, err := p.deviceRepo.PurgeDeletedBefore(now.Add(-p.retention))
+	if err != nil {
+		log.Println(err.ErrorStack())
+	}
+	if purged > 0 {
+		log.Printf("purged %d devices from the trash", purged)
+	}
+}
@@ -0,0 +1,33 @@
+package version
+
+import "runtime/debug"
+
+// Version is set when building a release with -ldflags "-X github.com/pc-power-api/src/version.Version=x.y.z"
+var Version = ""
+
+// Get returns the release version, or the commit the binary was built from when it is not a release
+func Get() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "dev"
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,148 @@
+package watchdog
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/pc-power-api/src/controller/gateway"
+	"github.com/pc-power-api/src/infra/entity"
+	"github.com/pc-power-api/src/infra/repo"
+	"log"
+	"sync"
+	"time"
+)
+
+const EvaluationPeriod = 30 * time.Second
+const DeviceOnStatus = 1
+
+// escalation keeps track of the progress made on a device whose heartbeat stopped
+type escalation struct {
+	heartbeat  time.Time
+	step       int
+	lastAction time.Time
+}
+
+type Evaluator struct {
+	watchdogRepo *repo.WatchdogRepository
+	deviceRepo   *repo.DeviceRepository
+	auditRepo    *repo.AuditRepository
+	escalations  map[string]*escalation
+	stop         chan struct{}
+	stopped      sync.WaitGroup
+}
+
+func NewEvaluator(watchdogRepo *repo.WatchdogRepository, deviceRepo *repo.DeviceRepository, auditRepo *repo.AuditRepository) *Evaluator {
+	return &Evaluator{
+		watchdogRepo: watchdogRepo,
+		deviceRepo:   deviceRepo,
+		auditRepo:    auditRepo,
+		escalations:  make(map[string]*escalation),
+		stop:         make(chan struct{}),
+	}
+}
+
+func (e *Evaluator) Start() {
+	e.stopped.Add(1)
+	go func() {
+		defer e.stopped.Done()
+		ticker := time.NewTicker(EvaluationPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-e.stop:
+				return
+			case now := <-ticker.C:
+				e.evaluate(now)
+			}
+		}
+	}()
+}
+
+// Stop waits for the evaluation in progress to end
+func (e *Evaluator) Stop() {
+	close(e.stop)
+	e.stopped.Wait()
+}
+
+func (e *Evaluator) evaluate(now time.Time) {
+	watchdogs, err := e.watchdogRepo.GetEnabled()
+	if err != nil {
+		log.Println(err.ErrorStack())
+		return
+	}
+
+	monitored := make(map[string]bool)
+	for i := range watchdogs {
+		monitored[watchdogs[i].DeviceID] = true
+		e.evaluateWatchdog(&watchdogs[i], now)
+	}
+	for deviceId := range e.escalations {
+		if !monitored[deviceId] {
+			delete(e.escalations, deviceId)
+		}
+	}
+}
+
+// evaluateWatchdog only escalates the devices connected to this instance so that a single instance acts on each device
+func (e *Evaluator) evaluateWatchdog(watchdog *entity.Watchdog, now time.Time) {
+	client, online := gateway.GetConnectedDevice(watchdog.DeviceID)
+	if !online || watchdog.LastHeartbeat == nil || len(watchdog.Steps) == 0 {
+		delete(e.escalations, watchdog.DeviceID)
+		return
+	}
+	timeout := time.Duration(watchdog.HeartbeatTimeout) * time.Second
+	if now.Sub(*watchdog.LastHeartbeat) < timeout {
+		delete(e.escalations, watchdog.DeviceID)
+		return
+	}
+
+	current, ok := e.escalations[watchdog.DeviceID]
+	if !ok || !current.heartbeat.Equal(*watchdog.LastHeartbeat) {
+		// The escalation only starts when the machine is supposed to be running, once started it goes on
+		// even if a step changed the reported status
+		if client.GetStatus() != DeviceOnStatus {
+			delete(e.escalations, watchdog.DeviceID)
+			return
+		}
+		current = &escalation{
+			heartbeat:  *watchdog.LastHeartbeat,
+			step:       0,
+			lastAction: watchdog.LastHeartbeat.Add(timeout),
+		}
+		e.escalations[watchdog.DeviceID] = current
+	}
+	if current.step >= len(watchdog.Steps) {
+		return
+	}
+
+	step := watchdog.Steps[current.step]
+	if now.Before(current.lastAction.Add(time.Duration(step.Delay) * time.Second)) {
+		return
+	}
+	current.step++
+	current.lastAction = now
+
+	details := fmt.Sprintf("step %d of %d, no heartbeat since %s", current.step, len(watchdog.Steps), watchdog.LastHeartbeat.Format(time.RFC3339))
+	if err := gateway.SendCommand(watchdog.DeviceID, step.Action); err != nil {
+		details += ", failed: " + err.Error()
+	}
+	e.audit(watchdog.DeviceID, step.Action, details)
+}
+
+func (e *Evaluator) audit(deviceId string, action string, details string) {
+	device, err := e.deviceRepo.GetById(deviceId)
+	if err != nil {
+		log.Println(err.ErrorStack())
+		return
+	}
+	err = e.auditRepo.Create(&entity.AuditEntry{
+		ID:       uuid.New().String(),
+		UserID:   device.UserID,
+		DeviceID: deviceId,
+		Actor:    entity.WatchdogActor,
+		Action:   action,
+		Details:  details,
+	})
+	if err != nil {
+		log.Println(err.ErrorStack())
+	}
+}